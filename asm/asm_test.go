@@ -0,0 +1,270 @@
+package asm_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/asm"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// translate translates the VM files of testdata named by files into a
+// program with the bootstrap and the runtime.
+func translate(t *testing.T, files ...string) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	tr := asm.NewTranslator(&out)
+	tr.WriteBootstrap()
+
+	for _, name := range files {
+		in, err := os.Open(filepath.Join("testdata", name+".vm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = tr.Translate(name, in)
+		in.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr.WriteRuntime()
+
+	if missing := tr.Unresolved(); len(missing) != 0 {
+		t.Fatalf("undefined functions %v", missing)
+	}
+
+	return out.Bytes()
+}
+
+// checkGolden compares got with the golden file fn of testdata, or
+// updates it when the tests are run with -update.
+func checkGolden(t *testing.T, fn string, got []byte) {
+	t.Helper()
+
+	fn = filepath.Join("testdata", fn)
+
+	if *update {
+		if err := os.WriteFile(fn, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("%s, run the tests with -update to create it", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the output, run the tests with -update to see the changes", fn)
+	}
+}
+
+// TestGolden translates and assembles the program of testdata and compares
+// the results with the golden files.
+func TestGolden(t *testing.T) {
+	program := translate(t, "Main", "Sys")
+	checkGolden(t, "Program.asm", program)
+
+	var hack bytes.Buffer
+
+	if err := asm.Assemble(bytes.NewReader(program), &hack); err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, "Program.hack", hack.Bytes())
+
+	// Sys.0 is the first variable
+	ram := runHack(t, hack.String(), 1000)
+	if ram[16] != 15 {
+		t.Errorf("want Sys.0 = 15, got %d", ram[16])
+	}
+}
+
+// runHack runs the Hack program for the given number of instructions and
+// returns the RAM.
+func runHack(t *testing.T, program string, steps int) []int16 {
+	t.Helper()
+
+	var rom []uint16
+
+	for _, line := range strings.Fields(program) {
+		v, err := strconv.ParseUint(line, 2, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rom = append(rom, uint16(v))
+	}
+
+	ram := make([]int16, 32768)
+	var a, d int16
+	pc := 0
+
+	for ; steps > 0 && pc < len(rom); steps-- {
+		instr := rom[pc]
+		pc++
+
+		if instr&0x8000 == 0 {
+			a = int16(instr)
+			continue
+		}
+
+		bit := func(n uint) bool { return instr&(1<<n) != 0 }
+
+		// the ALU: zx nx zy ny f no
+		x, y := d, a
+		if bit(12) {
+			y = ram[uint16(a)&0x7FFF]
+		}
+
+		if bit(11) {
+			x = 0
+		}
+
+		if bit(10) {
+			x = ^x
+		}
+
+		if bit(9) {
+			y = 0
+		}
+
+		if bit(8) {
+			y = ^y
+		}
+
+		out := x & y
+		if bit(7) {
+			out = x + y
+		}
+
+		if bit(6) {
+			out = ^out
+		}
+
+		// the destinations and the jump use A as it was before
+		addr := uint16(a) & 0x7FFF
+		target := int(uint16(a))
+
+		if bit(3) {
+			ram[addr] = out
+		}
+
+		if bit(4) {
+			d = out
+		}
+
+		if bit(5) {
+			a = out
+		}
+
+		if bit(2) && out < 0 || bit(1) && out == 0 || bit(0) && out > 0 {
+			pc = target
+		}
+	}
+
+	return ram
+}
+
+func TestAssemble(t *testing.T) {
+	// Add.asm of the course, with a label and a variable added
+	src := `// R0 = 2 + 3
+@2
+D=A
+@3
+D=D+A  // trailing comment
+@0
+M=D
+(END)
+@sum
+M=0
+@END
+0;JMP
+`
+
+	want := []string{
+		"0000000000000010",
+		"1110110000010000",
+		"0000000000000011",
+		"1110000010010000",
+		"0000000000000000",
+		"1110001100001000",
+		"0000000000010000", // @sum is the first variable, at 16
+		"1110101010001000",
+		"0000000000000110", // (END) is at 6
+		"1110101010000111",
+	}
+
+	var out bytes.Buffer
+
+	if err := asm.Assemble(strings.NewReader(src), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Fields(out.String()); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		msg string
+	}{
+		{"D=A\nD=Q", `line 2: invalid computation "Q"`},
+		{"@32768", `line 1: invalid constant "32768"`},
+		{"(L)\n(L)", "line 2: label L declared twice"},
+	}
+
+	for _, tt := range tests {
+		err := asm.Assemble(strings.NewReader(tt.src), &bytes.Buffer{})
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("%q: want error %s, got %v", tt.src, tt.msg, err)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		msg string
+	}{
+		{"function Main.f 0\npush nowhere 0", `Main.vm:2: unknown segment "nowhere"`},
+		{"function Main.f 0\npop constant 1", `Main.vm:2: unknown segment "constant"`},
+		{"function Main.f 0\njump", `Main.vm:2: malformed command "jump"`},
+	}
+
+	for _, tt := range tests {
+		tr := asm.NewTranslator(&bytes.Buffer{})
+
+		err := tr.Translate("Main", strings.NewReader(tt.src))
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("%q: want error %s, got %v", tt.src, tt.msg, err)
+		}
+	}
+}
+
+func TestUnresolved(t *testing.T) {
+	tr := asm.NewTranslator(&bytes.Buffer{})
+
+	err := tr.Translate("Main", strings.NewReader("function Main.f 0\ncall Main.g 0\ncall Math.abs 1\ncall Main.f 0\nreturn\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(tr.Unresolved(), " "); got != "Main.g Math.abs" {
+		t.Errorf("got unresolved %s, want Main.g Math.abs", got)
+	}
+}
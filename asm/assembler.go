@@ -0,0 +1,186 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// romSize is the number of instructions the Hack ROM can hold.
+const romSize = 32768
+
+// varBase is the RAM address of the first variable symbol.
+const varBase = 16
+
+type instruction struct {
+	text   string
+	lineNo int
+}
+
+// Assemble assembles Hack assembly read from in and writes the program to
+// out in the Hack binary text format, one 16-bit instruction per line.
+func Assemble(in io.Reader, out io.Writer) error {
+	instrs, labels, err := readInstructions(in)
+	if err != nil {
+		return err
+	}
+
+	if len(instrs) > romSize {
+		return fmt.Errorf("program has %d instructions but the ROM holds only %d", len(instrs), romSize)
+	}
+
+	symbols := map[string]uint16{}
+	for k, v := range predefined {
+		symbols[k] = v
+	}
+
+	for k, v := range labels {
+		symbols[k] = v
+	}
+
+	nextVar := uint16(varBase)
+
+	w := bufio.NewWriter(out)
+
+	for _, instr := range instrs {
+		var code uint16
+
+		if strings.HasPrefix(instr.text, "@") {
+			code, err = aInstruction(instr.text[1:], symbols, &nextVar)
+		} else {
+			code, err = cInstruction(instr.text)
+		}
+
+		if err != nil {
+			return fmt.Errorf("line %d: %s", instr.lineNo, err)
+		}
+
+		fmt.Fprintf(w, "%016b\n", code)
+	}
+
+	return w.Flush()
+}
+
+// readInstructions strips comments and whitespace and resolves the address
+// of every label declaration.
+func readInstructions(in io.Reader) ([]instruction, map[string]uint16, error) {
+	instrs := []instruction{}
+	labels := map[string]uint16{}
+
+	sc := bufio.NewScanner(in)
+	lineNo := 0
+
+	for sc.Scan() {
+		lineNo += 1
+
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.Join(strings.Fields(line), "")
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "(") {
+			if !strings.HasSuffix(line, ")") {
+				return nil, nil, fmt.Errorf("line %d: malformed label %q", lineNo, line)
+			}
+
+			lbl := line[1 : len(line)-1]
+			if !isSymbol(lbl) {
+				return nil, nil, fmt.Errorf("line %d: invalid label %q", lineNo, lbl)
+			}
+
+			if _, exists := labels[lbl]; exists {
+				return nil, nil, fmt.Errorf("line %d: label %s declared twice", lineNo, lbl)
+			}
+
+			labels[lbl] = uint16(len(instrs))
+
+			continue
+		}
+
+		instrs = append(instrs, instruction{line, lineNo})
+	}
+
+	return instrs, labels, sc.Err()
+}
+
+func aInstruction(val string, symbols map[string]uint16, nextVar *uint16) (uint16, error) {
+	if len(val) > 0 && val[0] >= '0' && val[0] <= '9' {
+		n, err := strconv.ParseUint(val, 10, 15)
+		if err != nil {
+			return 0, fmt.Errorf("invalid constant %q", val)
+		}
+
+		return uint16(n), nil
+	}
+
+	if !isSymbol(val) {
+		return 0, fmt.Errorf("invalid symbol %q", val)
+	}
+
+	addr, exists := symbols[val]
+	if !exists {
+		addr = *nextVar
+		symbols[val] = addr
+		*nextVar += 1
+	}
+
+	return addr, nil
+}
+
+func cInstruction(instr string) (uint16, error) {
+	dest, comp, jump := "", instr, ""
+
+	if i := strings.Index(comp, "="); i >= 0 {
+		dest, comp = comp[:i], comp[i+1:]
+	}
+
+	if i := strings.Index(comp, ";"); i >= 0 {
+		comp, jump = comp[:i], comp[i+1:]
+	}
+
+	c, exists := comps[comp]
+	if !exists {
+		return 0, fmt.Errorf("invalid computation %q", comp)
+	}
+
+	d := uint16(0)
+	for _, r := range dest {
+		bit, exists := dests[r]
+		if !exists || d&bit != 0 {
+			return 0, fmt.Errorf("invalid destination %q", dest)
+		}
+
+		d |= bit
+	}
+
+	j, exists := jumps[jump]
+	if !exists {
+		return 0, fmt.Errorf("invalid jump %q", jump)
+	}
+
+	return 0xe000 | c<<6 | d<<3 | j, nil
+}
+
+func isSymbol(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("_.$:", r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,294 @@
+@256
+D=A
+@SP
+M=D
+@0
+D=A
+@R13
+M=D
+@Sys.init
+D=A
+@R14
+M=D
+@$$RET0
+D=A
+@$$CALL
+0;JMP
+($$RET0)
+($$HALT)
+@$$HALT
+0;JMP
+(Main.add)
+@SP
+A=M
+M=0
+@SP
+M=M+1
+@0
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@1
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@SP
+AM=M-1
+D=M
+A=A-1
+M=D+M
+@0
+D=A
+@LCL
+D=D+M
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@R13
+A=M
+M=D
+@0
+D=A
+@LCL
+A=D+M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@15
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@$$RET1
+D=A
+@$$GT
+0;JMP
+($$RET1)
+@SP
+AM=M-1
+D=M
+@Main.add$BIG
+D;JNE
+@0
+D=A
+@LCL
+A=D+M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@$$RETURN
+0;JMP
+(Main.add$BIG)
+@0
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@$$RETURN
+0;JMP
+(Sys.init)
+@7
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@8
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@2
+D=A
+@R13
+M=D
+@Main.add
+D=A
+@R14
+M=D
+@$$RET2
+D=A
+@$$CALL
+0;JMP
+($$RET2)
+@SP
+AM=M-1
+D=M
+@Sys.0
+M=D
+(Sys.init$LOOP)
+@Sys.init$LOOP
+0;JMP
+($$CALL)
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@LCL
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@ARG
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@THIS
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@THAT
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@SP
+D=M
+@5
+D=D-A
+@R13
+D=D-M
+@ARG
+M=D
+@SP
+D=M
+@LCL
+M=D
+@R14
+A=M
+0;JMP
+($$RETURN)
+@LCL
+D=M
+@R13
+M=D
+@5
+A=D-A
+D=M
+@R14
+M=D
+@SP
+AM=M-1
+D=M
+@ARG
+A=M
+M=D
+@ARG
+D=M+1
+@SP
+M=D
+@R13
+AM=M-1
+D=M
+@THAT
+M=D
+@R13
+AM=M-1
+D=M
+@THIS
+M=D
+@R13
+AM=M-1
+D=M
+@ARG
+M=D
+@R13
+AM=M-1
+D=M
+@LCL
+M=D
+@R14
+A=M
+0;JMP
+($$EQ)
+@R15
+M=D
+@SP
+AM=M-1
+D=M
+A=A-1
+D=M-D
+M=-1
+@$$EQ_END
+D;JEQ
+@SP
+A=M-1
+M=0
+($$EQ_END)
+@R15
+A=M
+0;JMP
+($$GT)
+@R15
+M=D
+@SP
+AM=M-1
+D=M
+A=A-1
+D=M-D
+M=-1
+@$$GT_END
+D;JGT
+@SP
+A=M-1
+M=0
+($$GT_END)
+@R15
+A=M
+0;JMP
+($$LT)
+@R15
+M=D
+@SP
+AM=M-1
+D=M
+A=A-1
+D=M-D
+M=-1
+@$$LT_END
+D;JLT
+@SP
+A=M-1
+M=0
+($$LT_END)
+@R15
+A=M
+0;JMP
@@ -0,0 +1,326 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Translator translates VM commands into Hack assembly. Calls, returns and
+// comparisons jump to shared runtime routines, written by WriteRuntime, to
+// keep the generated program small enough for the Hack ROM.
+type Translator struct {
+	out      io.Writer
+	fileName string
+	funcName string
+	retIdx   uint
+	funcs    map[string]bool
+	calls    map[string]bool
+}
+
+var segPointers = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+var binOps = map[string]string{
+	"add": "M=D+M",
+	"sub": "M=M-D",
+	"and": "M=D&M",
+	"or":  "M=D|M",
+}
+
+var unOps = map[string]string{
+	"neg": "M=-M",
+	"not": "M=!M",
+}
+
+var cmpOps = map[string]string{
+	"eq": "JEQ",
+	"gt": "JGT",
+	"lt": "JLT",
+}
+
+// osClasses are the classes of the Jack OS.
+var osClasses = map[string]bool{
+	"Array":    true,
+	"Keyboard": true,
+	"Math":     true,
+	"Memory":   true,
+	"Output":   true,
+	"Screen":   true,
+	"String":   true,
+	"Sys":      true,
+}
+
+// IsOSClass reports whether class is one of the classes of the Jack OS.
+func IsOSClass(class string) bool {
+	return osClasses[class]
+}
+
+func NewTranslator(out io.Writer) *Translator {
+	return &Translator{out, "", "", 0, map[string]bool{}, map[string]bool{}}
+}
+
+// Unresolved returns the names of the functions that are called but not
+// defined in any of the translated files.
+func (t *Translator) Unresolved() []string {
+	names := []string{}
+
+	for name := range t.calls {
+		if !t.funcs[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// WriteBootstrap writes the code that initializes the stack pointer and calls
+// Sys.init.
+func (t *Translator) WriteBootstrap() {
+	t.write("@256", "D=A", "@SP", "M=D")
+	t.writeCall("Sys.init", 0)
+	t.write("($$HALT)", "@$$HALT", "0;JMP")
+}
+
+// WriteRuntime writes the routines shared by every call, return and
+// comparison in the translated program.
+func (t *Translator) WriteRuntime() {
+	// R13 = nArgs, R14 = callee address, D = return address
+	t.write("($$CALL)")
+	t.writePushD()
+	for _, p := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		t.write("@"+p, "D=M")
+		t.writePushD()
+	}
+	t.write(
+		"@SP", "D=M", "@5", "D=D-A", "@R13", "D=D-M", "@ARG", "M=D",
+		"@SP", "D=M", "@LCL", "M=D",
+		"@R14", "A=M", "0;JMP",
+	)
+
+	t.write(
+		"($$RETURN)",
+		"@LCL", "D=M", "@R13", "M=D",
+		"@5", "A=D-A", "D=M", "@R14", "M=D",
+		"@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D",
+		"@ARG", "D=M+1", "@SP", "M=D",
+	)
+	for _, p := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		t.write("@R13", "AM=M-1", "D=M", "@"+p, "M=D")
+	}
+	t.write("@R14", "A=M", "0;JMP")
+
+	// R15 = return address
+	for _, op := range []string{"eq", "gt", "lt"} {
+		name := "$$" + strings.ToUpper(op)
+		t.write(
+			"("+name+")", "@R15", "M=D",
+			"@SP", "AM=M-1", "D=M", "A=A-1", "D=M-D", "M=-1",
+			"@"+name+"_END", "D;"+cmpOps[op],
+			"@SP", "A=M-1", "M=0",
+			"("+name+"_END)", "@R15", "A=M", "0;JMP",
+		)
+	}
+}
+
+// Translate translates the VM commands of a single file. fileName is the
+// name of the file without the .vm suffix and it is used to name the static
+// variables of the file.
+func (t *Translator) Translate(fileName string, in io.Reader) error {
+	t.fileName = fileName
+	t.funcName = ""
+
+	sc := bufio.NewScanner(in)
+	lineNo := 0
+
+	for sc.Scan() {
+		lineNo += 1
+
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		err := t.translateCommand(fields)
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %s", fileName, lineNo, err)
+		}
+	}
+
+	return sc.Err()
+}
+
+func (t *Translator) translateCommand(fields []string) error {
+	cmd := fields[0]
+
+	switch {
+	case binOps[cmd] != "":
+		t.write("@SP", "AM=M-1", "D=M", "A=A-1", binOps[cmd])
+		return nil
+	case unOps[cmd] != "":
+		t.write("@SP", "A=M-1", unOps[cmd])
+		return nil
+	case cmpOps[cmd] != "":
+		ret := t.registerReturn()
+		t.write("@"+ret, "D=A", "@$$"+strings.ToUpper(cmd), "0;JMP", "("+ret+")")
+		return nil
+	case cmd == "return":
+		t.write("@$$RETURN", "0;JMP")
+		return nil
+	}
+
+	if len(fields) < 2 {
+		return fmt.Errorf("malformed command %q", strings.Join(fields, " "))
+	}
+
+	switch cmd {
+	case "label":
+		t.write("(" + t.label(fields[1]) + ")")
+		return nil
+	case "goto":
+		t.write("@"+t.label(fields[1]), "0;JMP")
+		return nil
+	case "if-goto":
+		t.write("@SP", "AM=M-1", "D=M", "@"+t.label(fields[1]), "D;JNE")
+		return nil
+	}
+
+	if len(fields) < 3 {
+		return fmt.Errorf("malformed command %q", strings.Join(fields, " "))
+	}
+
+	n, err := strconv.ParseUint(fields[2], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid index %q", fields[2])
+	}
+
+	idx := uint(n)
+
+	switch cmd {
+	case "push":
+		return t.writePush(fields[1], idx)
+	case "pop":
+		return t.writePop(fields[1], idx)
+	case "function":
+		if t.funcs[fields[1]] {
+			return fmt.Errorf("function %s defined twice", fields[1])
+		}
+		t.funcs[fields[1]] = true
+		t.funcName = fields[1]
+		t.write("(" + fields[1] + ")")
+		for i := uint(0); i < idx; i++ {
+			t.write("@SP", "A=M", "M=0", "@SP", "M=M+1")
+		}
+		return nil
+	case "call":
+		t.writeCall(fields[1], idx)
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func (t *Translator) writePush(seg string, idx uint) error {
+	switch seg {
+	case "constant":
+		t.write(fmt.Sprintf("@%d", idx), "D=A")
+	case "local", "argument", "this", "that":
+		t.write(fmt.Sprintf("@%d", idx), "D=A", "@"+segPointers[seg], "A=D+M", "D=M")
+	default:
+		addr, err := t.fixedAddress(seg, idx)
+		if err != nil {
+			return err
+		}
+		t.write("@"+addr, "D=M")
+	}
+
+	t.writePushD()
+
+	return nil
+}
+
+func (t *Translator) writePop(seg string, idx uint) error {
+	switch seg {
+	case "local", "argument", "this", "that":
+		t.write(
+			fmt.Sprintf("@%d", idx), "D=A", "@"+segPointers[seg], "D=D+M", "@R13", "M=D",
+			"@SP", "AM=M-1", "D=M", "@R13", "A=M", "M=D",
+		)
+	default:
+		addr, err := t.fixedAddress(seg, idx)
+		if err != nil {
+			return err
+		}
+		t.write("@SP", "AM=M-1", "D=M", "@"+addr, "M=D")
+	}
+
+	return nil
+}
+
+func (t *Translator) fixedAddress(seg string, idx uint) (string, error) {
+	switch seg {
+	case "static":
+		return fmt.Sprintf("%s.%d", t.fileName, idx), nil
+	case "temp":
+		if idx > 7 {
+			return "", fmt.Errorf("temp index %d out of range", idx)
+		}
+		return fmt.Sprintf("R%d", 5+idx), nil
+	case "pointer":
+		if idx > 1 {
+			return "", fmt.Errorf("pointer index %d out of range", idx)
+		}
+		return fmt.Sprintf("R%d", 3+idx), nil
+	}
+
+	return "", fmt.Errorf("unknown segment %q", seg)
+}
+
+func (t *Translator) writeCall(name string, nArgs uint) {
+	ret := t.registerReturn()
+
+	t.calls[name] = true
+
+	t.write(
+		fmt.Sprintf("@%d", nArgs), "D=A", "@R13", "M=D",
+		"@"+name, "D=A", "@R14", "M=D",
+		"@"+ret, "D=A", "@$$CALL", "0;JMP",
+		"("+ret+")",
+	)
+}
+
+func (t *Translator) writePushD() {
+	t.write("@SP", "A=M", "M=D", "@SP", "M=M+1")
+}
+
+func (t *Translator) label(lbl string) string {
+	return t.funcName + "$" + lbl
+}
+
+func (t *Translator) registerReturn() string {
+	idx := t.retIdx
+
+	t.retIdx += 1
+
+	return fmt.Sprintf("$$RET%d", idx)
+}
+
+func (t *Translator) write(lines ...string) {
+	for _, l := range lines {
+		io.WriteString(t.out, l+"\n")
+	}
+}
@@ -1,8 +1,10 @@
 package compilationengine
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
 	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
@@ -14,10 +16,81 @@ type Service struct {
 	symbolTable *symbols.Table
 	vmWriter    *vm.Writer
 	className   string
+	recorder    Recorder
+	loops       []loop
+	precedence  bool
+	strict      bool
+	warnings    []*Error
+	constants   *Constants
+	// enums are the enums declared by the class.
+	enums map[string]bool
+	// exprType is the type of the term or the expression compiled last, or
+	// empty if it is not known.
+	exprType string
+}
+
+// BinaryOps are the binary operators of Jack and Jack+, shared with the
+// formatter.
+var BinaryOps = []string{"+", "-", "*", "/", "&", "|", "<", ">", "=", "&&", "||", "%", "<<", ">>", "^", "<=", ">=", "!="}
+
+// precedences are the precedences of the binary operators in precedence
+// mode. Operators with a higher precedence bind tighter.
+var precedences = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"&":  3,
+	"|":  3,
+	"^":  3,
+	"<":  4,
+	">":  4,
+	"=":  4,
+	"<=": 4,
+	">=": 4,
+	"!=": 4,
+	"<<": 5,
+	">>": 5,
+	"+":  6,
+	"-":  6,
+	"*":  7,
+	"/":  7,
+	"%":  7,
+}
+
+// loop holds the labels break and continue statements jump to in the
+// innermost loop.
+type loop struct {
+	lblContinue string
+	lblBreak    string
 }
 
 func New(t *tokenizer.Service, vmWriter *vm.Writer) *Service {
-	return &Service{t, symbols.New(), vmWriter, ""}
+	return &Service{
+		tokenizer:   t,
+		symbolTable: symbols.New(),
+		vmWriter:    vmWriter,
+		recorder:    nopRecorder{},
+		constants:   NewConstants(),
+		enums:       map[string]bool{},
+	}
+}
+
+// SetPrecedence sets whether binary operators are applied by precedence
+// instead of strictly from left to right.
+func (s *Service) SetPrecedence(on bool) {
+	s.precedence = on
+}
+
+// SetStrict sets whether assignments are type checked where Jack+ knows the
+// types, which gives warnings for values of other types assigned to enum
+// variables.
+func (s *Service) SetStrict(on bool) {
+	s.strict = on
+}
+
+// Warnings returns the warnings of the compilation, such as expressions
+// that mean different things with and without operator precedence.
+func (s *Service) Warnings() []*Error {
+	return s.warnings
 }
 
 func (s *Service) Compile() error {
@@ -36,23 +109,22 @@ func (s *Service) compileClass(t tokenizer.Terminal) error {
 	}
 
 	s.className = t.Identifier
+	s.recorder.DeclareClass(t)
 
 	t, err = s.eatSymbol("{")
 	if err != nil {
 		return err
 	}
 
-	for {
-		err = s.compileClassVarDec()
-		if err != nil {
-			break
-		}
+	err = s.compileClassVarDecs()
+	if err != nil {
+		return err
 	}
 
-	for {
+	for s.nextIsKeyword("constructor", "function", "method") {
 		err = s.compileSubroutineDec()
 		if err != nil {
-			break
+			return err
 		}
 	}
 
@@ -70,12 +142,14 @@ func (s *Service) compileSubroutineDec() error {
 		return err
 	}
 
-	t, err := s.eatReturnType()
+	rt, err := s.eatReturnType()
 	if err != nil {
 		return err
 	}
 
-	t, err = s.eatIdentifier()
+	s.useType(rt)
+
+	t, err := s.eatIdentifier()
 	if err != nil {
 		return err
 	}
@@ -83,6 +157,7 @@ func (s *Service) compileSubroutineDec() error {
 	funcName := t.Identifier
 
 	s.symbolTable.SwitchSubroutineTo(t.Identifier, tt.Keyword)
+	s.recorder.DeclareSubroutine(t, tt.Keyword, s.getType(rt))
 
 	t, err = s.eatSymbol("(")
 	if err != nil {
@@ -113,10 +188,10 @@ func (s *Service) compileSubroutineBody(funcName, funcType string) error {
 		return err
 	}
 
-	for {
+	for s.nextIsKeyword("var") {
 		err = s.compileVarDec()
 		if err != nil {
-			break
+			return err
 		}
 	}
 
@@ -141,17 +216,19 @@ func (s *Service) compileSubroutineBody(funcName, funcType string) error {
 		return err
 	}
 
-	_, err = s.eatSymbol("}")
+	t, err := s.eatSymbol("}")
 	if err != nil {
 		return err
 	}
 
+	s.recorder.EndSubroutine(t)
+
 	return nil
 }
 
 func (s *Service) compileStatements(funcType string) error {
 	for {
-		t, err := s.eatKeyword("let", "if", "while", "do", "return")
+		t, err := s.eatKeyword("let", "if", "while", "for", "do", "return", "break", "continue")
 		if err != nil {
 			break
 		}
@@ -163,10 +240,14 @@ func (s *Service) compileStatements(funcType string) error {
 			err = s.compileIfStatement(t)
 		case "while":
 			err = s.compileWhileStatement(t)
+		case "for":
+			err = s.compileForStatement(t)
 		case "do":
 			err = s.compileDoStatement(t)
 		case "return":
 			err = s.compileReturnStatement(t, funcType)
+		case "break", "continue":
+			err = s.compileJumpStatement(t)
 		}
 
 		if err != nil {
@@ -213,6 +294,7 @@ func (s *Service) compileSubroutineCall() error {
 
 	totalArgs := uint(0)
 
+	head := t
 	idHead = t.Identifier
 	targetClass := ""
 
@@ -231,12 +313,20 @@ func (s *Service) compileSubroutineCall() error {
 		e := s.symbolTable.Get(idHead)
 		if e == nil {
 			targetClass = idHead
+			s.recorder.UseClass(head)
+
+			if s.extensions() && idHead == "Array" && idTail.Identifier == "from" {
+				return s.compileArrayFrom()
+			}
 		} else {
 			targetClass = e.Type
 			totalArgs = 1
-			s.vmWriter.WritePush(e.Scope.ToVMMemSeg(), e.Idx)
+			s.recorder.UseVariable(head, e)
+			s.pushVariable(e)
 		}
 
+		s.recorder.UseSubroutine(idTail, targetClass)
+
 		t, err = s.eatSymbol("(")
 		if err != nil {
 			return err
@@ -247,6 +337,7 @@ func (s *Service) compileSubroutineCall() error {
 		if targetClass == "" {
 			id = s.className + "." + idHead
 			totalArgs = 1
+			s.recorder.UseSubroutine(head, s.className)
 			s.vmWriter.WritePush(vm.Pointer, 0)
 		} else {
 			id = targetClass + "." + idTail.Identifier
@@ -276,12 +367,186 @@ func (s *Service) pushStringConstant(str string) {
 	s.vmWriter.WritePush(vm.Const, strLen)
 	s.vmWriter.WriteCall("String.new", 1)
 
-	for _, c := range str {
-		s.vmWriter.WritePush(vm.Const, uint(c))
+	for i := 0; i < len(str); i++ {
+		s.vmWriter.WritePush(vm.Const, uint(str[i]))
 		s.vmWriter.WriteCall("String.appendChar", 2)
 	}
 }
 
+// pushIntegerConstant pushes the Jack+ integer constant t, negated if neg
+// is set.
+func (s *Service) pushIntegerConstant(t tokenizer.Terminal, neg bool) error {
+	v, err := integerValue(t, neg)
+	if err != nil {
+		return err
+	}
+
+	s.pushInteger(v)
+	s.exprType = "int"
+
+	return nil
+}
+
+// integerValue returns the value of the Jack+ integer constant t, negated
+// if neg is set.
+func integerValue(t tokenizer.Terminal, neg bool) (int, error) {
+	v, err := tokenizer.ParseInteger(t.IntegerConstant)
+	if err != nil {
+		return 0, ErrorAt(t, "%s", err)
+	}
+
+	if neg {
+		return int(int16(-v)), nil
+	}
+
+	if v > 32767 {
+		return 0, ErrorAt(t, "integer constant %s out of 16 bits, only -%s is valid", t.IntegerConstant, t.IntegerConstant)
+	}
+
+	return v, nil
+}
+
+// pushInteger pushes the 16-bit value v. The values push constant cannot
+// express are computed with neg or not.
+func (s *Service) pushInteger(v int) {
+	switch {
+	case v >= 0:
+		s.vmWriter.WritePush(vm.Const, uint(v))
+	case v == -32768:
+		s.vmWriter.WritePush(vm.Const, 32767)
+		s.vmWriter.WriteArithmetic(vm.Not)
+	default:
+		s.vmWriter.WritePush(vm.Const, uint(-v))
+		s.vmWriter.WriteArithmetic(vm.Neg)
+	}
+}
+
+// checkAssignment warns in strict mode if the value starting at the token
+// value is of another type than the enum variable e it is assigned to.
+func (s *Service) checkAssignment(value tokenizer.Terminal, e *symbols.Entry) {
+	if !s.strict || !s.isEnum(e.Type) || s.exprType == "" || s.exprType == e.Type {
+		return
+	}
+
+	s.warnings = append(s.warnings, &Error{value.Pos, fmt.Sprintf("%s assigned to %s %s", s.exprType, e.Type, e.Name)})
+}
+
+// pushVariable pushes the value of the variable e, inlining the value of a
+// constant.
+func (s *Service) pushVariable(e *symbols.Entry) {
+	if e.Scope == symbols.Constant {
+		s.pushInteger(e.Value)
+		return
+	}
+
+	s.vmWriter.WritePush(e.Scope.ToVMMemSeg(), e.Idx)
+}
+
+// compileArrayLiteral compiles an array literal of Jack+ following the
+// opening bracket into a new array holding the values of the elements.
+func (s *Service) compileArrayLiteral(open tokenizer.Terminal) error {
+	if s.nextIsSymbol("]") {
+		return ErrorAt(open, "empty array literal")
+	}
+
+	// the size of the array is known only after the elements
+	var elems bytes.Buffer
+	out := s.vmWriter.Divert(&elems)
+	n, err := s.compileElements()
+	s.vmWriter.Divert(out)
+
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WritePush(vm.Const, uint(n))
+	s.vmWriter.WriteCall("Array.new", 1)
+	s.vmWriter.WriteCode(elems.Bytes())
+	s.exprType = "Array"
+
+	return nil
+}
+
+// compileElements compiles the elements of an array literal up to the
+// closing bracket, storing each to the array on the stack, and returns the
+// number of elements.
+func (s *Service) compileElements() (int, error) {
+	for n := 0; ; n++ {
+		s.writeElementAddress(n)
+
+		err := s.compileExpression()
+		if err != nil {
+			return 0, err
+		}
+
+		s.writeElementStore()
+
+		t, err := s.eatSymbol(",", "]")
+		if err != nil {
+			return 0, err
+		}
+
+		if t.Symbol == "]" {
+			return n + 1, nil
+		}
+	}
+}
+
+// compileArrayFrom compiles Array.from of Jack+ following the name, which
+// makes a new array of the characters of a string constant. It gives
+// lookup tables a compact form, as in Array.from("\x01\x03\x07").
+func (s *Service) compileArrayFrom() error {
+	_, err := s.eatSymbol("(")
+	if err != nil {
+		return err
+	}
+
+	t := s.eat()
+	if !t.IsOfType(tokenizer.StringConstant) || t.StringConstant == "" {
+		return ErrorAt(t, "expected a string constant of at least one character but token was %s", t)
+	}
+
+	_, err = s.eatSymbol(")")
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WritePush(vm.Const, uint(len(t.StringConstant)))
+	s.vmWriter.WriteCall("Array.new", 1)
+
+	for i := 0; i < len(t.StringConstant); i++ {
+		s.writeElementAddress(i)
+		s.vmWriter.WritePush(vm.Const, uint(t.StringConstant[i]))
+		s.writeElementStore()
+	}
+
+	s.exprType = "Array"
+
+	return nil
+}
+
+// writeElementAddress pushes the address of the element i of the array on
+// the stack, keeping the array below it.
+func (s *Service) writeElementAddress(i int) {
+	s.vmWriter.WritePop(vm.Pointer, 1)
+	s.vmWriter.WritePush(vm.Pointer, 1)
+	s.vmWriter.WritePush(vm.Pointer, 1)
+
+	if i > 0 {
+		s.vmWriter.WritePush(vm.Const, uint(i))
+		s.vmWriter.WriteArithmetic(vm.Add)
+	}
+}
+
+// writeElementStore stores the value on the stack to the element whose
+// address is below it.
+func (s *Service) writeElementStore() {
+	s.vmWriter.WritePop(vm.Temp, 0)
+	s.vmWriter.WritePop(vm.Pointer, 1)
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePop(vm.That, 0)
+}
+
 func (s *Service) pushKeywordConstant(c string) {
 	switch c {
 	case "true":
@@ -296,27 +561,61 @@ func (s *Service) pushKeywordConstant(c string) {
 
 func (s *Service) compileTerm() error {
 	t := s.eat()
+	s.exprType = ""
 
 	switch tt := t.Type; tt {
 	case tokenizer.IntegerConstant:
+		if s.extensions() {
+			return s.pushIntegerConstant(t, false)
+		}
+
 		i, _ := strconv.Atoi(t.IntegerConstant)
 		s.vmWriter.WritePush(vm.Const, uint(i))
+		s.exprType = "int"
 	case tokenizer.StringConstant:
 		s.pushStringConstant(t.StringConstant)
+		s.exprType = "String"
+	case tokenizer.CharConstant:
+		s.vmWriter.WritePush(vm.Const, uint(t.CharConstant[0]))
+		s.exprType = "char"
 	case tokenizer.Keyword:
+		if !t.IsKeyword("true", "false", "null", "this") {
+			return ErrorAt(t, "expected a term but token was %s", t)
+		}
+
 		s.pushKeywordConstant(t.Keyword)
+
+		if t.IsKeyword("true", "false") {
+			s.exprType = "boolean"
+		}
 	case tokenizer.Identifier:
 		t2, err := s.eatSymbol("(", "[", ".")
 		if err != nil {
 			e := s.symbolTable.Get(t.Identifier)
+			if e == nil {
+				return ErrorAt(t, "undefined variable %s", t.Identifier)
+			}
 
-			s.vmWriter.WritePush(e.Scope.ToVMMemSeg(), e.Idx)
+			s.recorder.UseVariable(t, e)
+			s.pushVariable(e)
+			s.exprType = e.Type
 
 			break
 		}
 
 		switch sym := t2.Symbol; sym {
 		case ".":
+			if s.extensions() {
+				isConst, err := s.compileClassConstant(t)
+				if err != nil {
+					return err
+				}
+
+				if isConst {
+					break
+				}
+			}
+
 			fallthrough
 		case "(":
 			s.tokenizer.Rewind(1)
@@ -325,27 +624,39 @@ func (s *Service) compileTerm() error {
 			if err != nil {
 				return err
 			}
+
+			s.exprType = ""
 		case "[":
 			e := s.symbolTable.Get(t.Identifier)
+			if e == nil {
+				return ErrorAt(t, "undefined variable %s", t.Identifier)
+			}
 
-			s.vmWriter.WritePush(e.Scope.ToVMMemSeg(), e.Idx)
+			s.recorder.UseVariable(t, e)
+			s.pushVariable(e)
 
-			err = s.compileExpression()
+			err = s.compileSubscript()
 			if err != nil {
 				return err
 			}
 
-			t, err = s.eatSymbol("]")
+			err = s.compileChainedSubscripts()
 			if err != nil {
 				return err
 			}
 
-			s.vmWriter.WriteArithmetic(vm.Add)
 			s.vmWriter.WritePop(vm.Pointer, 1)
 			s.vmWriter.WritePush(vm.That, 0)
+			s.exprType = ""
 		}
 	case tokenizer.Symbol:
 		switch sym := t.Symbol; sym {
+		case "[":
+			if !s.extensions() {
+				return ErrorAt(t, "expected a term but token was %s", t)
+			}
+
+			return s.compileArrayLiteral(t)
 		case "(":
 			err := s.compileExpression()
 			if err != nil {
@@ -357,6 +668,15 @@ func (s *Service) compileTerm() error {
 				return err
 			}
 		case "-":
+			// a negated constant of Jack+ is a constant itself, which
+			// is how -32768 is written
+			if s.extensions() {
+				s.tokenizer.Advance()
+				if t2 := s.tokenizer.Token(); t2.IsOfType(tokenizer.IntegerConstant) {
+					return s.pushIntegerConstant(s.eat(), true)
+				}
+			}
+
 			fallthrough
 		case "~":
 			err := s.compileTerm()
@@ -365,6 +685,51 @@ func (s *Service) compileTerm() error {
 			}
 
 			s.vmWriter.WriteArithmetic(t.VMUnOp())
+
+			if t.Symbol == "-" {
+				s.exprType = "int"
+			}
+		default:
+			return ErrorAt(t, "expected a term but token was %s", t)
+		}
+	default:
+		return ErrorAt(t, "expected a term but token was %s", t)
+	}
+
+	return nil
+}
+
+// compileSubscript compiles the index following an opening bracket and
+// adds it to the address of the array on the stack.
+func (s *Service) compileSubscript() error {
+	err := s.compileExpression()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol("]")
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WriteArithmetic(vm.Add)
+
+	return nil
+}
+
+// compileChainedSubscripts compiles the subscripts of Jack+ following the
+// first one, as in grid[y][x], with the address of an element on the stack.
+// The element is read as the next array before the next index is
+// computed, so no address is kept in pointer 1 while computing an index.
+func (s *Service) compileChainedSubscripts() error {
+	for s.extensions() && s.nextIsSymbol("[") {
+		s.eat()
+		s.vmWriter.WritePop(vm.Pointer, 1)
+		s.vmWriter.WritePush(vm.That, 0)
+
+		err := s.compileSubscript()
+		if err != nil {
+			return err
 		}
 	}
 
@@ -377,30 +742,222 @@ func (s *Service) compileExpression() error {
 		return err
 	}
 
-	t, err := s.eatBinOp()
-	if err == nil {
-		err = s.compileTerm()
+	err = s.compileOperations(0, &opChain{})
+	if err != nil {
+		return err
+	}
+
+	if s.extensions() && s.nextIsSymbol("?") {
+		return s.compileConditional()
+	}
+
+	return nil
+}
+
+// compileConditional compiles the branches of a conditional expression of
+// Jack+, cond ? a : b, with the value of the condition on the stack. Only
+// the chosen branch is evaluated, leaving its value on the stack. The
+// conditional binds looser than any operator and nests to the right, so
+// c1 ? a : c2 ? b : c means c1 ? a : (c2 ? b : c).
+func (s *Service) compileConditional() error {
+	s.eat()
+
+	lblFalse := s.vmWriter.RegisterLabel("COND_FALSE")
+	lblEnd := s.vmWriter.RegisterLabel("COND_END")
+
+	// any value other than 0 is true
+	s.vmWriter.WritePush(vm.Const, 0)
+	s.vmWriter.WriteArithmetic(vm.Eq)
+	s.vmWriter.WriteIf(lblFalse)
+
+	err := s.compileExpression()
+	if err != nil {
+		return err
+	}
+
+	tp := s.exprType
+
+	_, err = s.eatSymbol(":")
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WriteGoto(lblEnd)
+	s.vmWriter.WriteLabel(lblFalse)
+
+	err = s.compileExpression()
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WriteLabel(lblEnd)
+
+	if s.exprType != tp {
+		s.exprType = ""
+	}
+
+	return nil
+}
+
+// opChain tracks the binary operators of an expression in source order to
+// find where the meaning of the expression depends on the precedence mode.
+type opChain struct {
+	last   tokenizer.Terminal
+	warned bool
+}
+
+// compileOperations compiles the binary operations following an operand
+// whose value is on the stack. In precedence mode the operations with
+// operators binding looser than min are left to the caller, otherwise the
+// operators are applied strictly from left to right.
+func (s *Service) compileOperations(min int, chain *opChain) error {
+	for s.nextIsSymbol(BinaryOps...) {
+		op := s.tokenizer.Token()
+		if s.precedence && precedences[op.Symbol] < min {
+			return nil
+		}
+
+		s.eat()
+		s.checkPrecedence(op, chain)
+
+		if op.IsSymbol("&&", "||") {
+			err := s.compileShortCircuit(op, chain)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err := s.compileOperand(op, chain)
 		if err != nil {
 			return err
 		}
 
-		switch t.Symbol {
-		case "*":
-			s.vmWriter.WriteCall("Math.multiply", 2)
-		case "/":
-			s.vmWriter.WriteCall("Math.divide", 2)
-		default:
-			s.vmWriter.WriteArithmetic(t.VMBinOp())
+		s.writeBinOp(op)
+
+		s.exprType = "int"
+		if op.IsSymbol("<", ">", "=", "<=", ">=", "!=") {
+			s.exprType = "boolean"
 		}
 	}
 
 	return nil
 }
 
+// writeBinOp writes the binary operation of the operator op on the two
+// values on the stack.
+func (s *Service) writeBinOp(op tokenizer.Terminal) {
+	switch op.Symbol {
+	case "*":
+		s.vmWriter.WriteCall("Math.multiply", 2)
+	case "/":
+		s.vmWriter.WriteCall("Math.divide", 2)
+	case "%":
+		s.writeModulo()
+	case "<<":
+		s.writeShiftLeft()
+	case ">>":
+		s.writeShiftRight()
+	case "^":
+		s.writeXor()
+	case "<=":
+		s.vmWriter.WriteArithmetic(vm.Gt)
+		s.vmWriter.WriteArithmetic(vm.Not)
+	case ">=":
+		s.vmWriter.WriteArithmetic(vm.Lt)
+		s.vmWriter.WriteArithmetic(vm.Not)
+	case "!=":
+		s.vmWriter.WriteArithmetic(vm.Eq)
+		s.vmWriter.WriteArithmetic(vm.Not)
+	default:
+		s.vmWriter.WriteArithmetic(op.VMBinOp())
+	}
+}
+
+// compileOperand compiles the right operand of the operator op. In
+// precedence mode the operand extends over the operations binding tighter
+// than op.
+func (s *Service) compileOperand(op tokenizer.Terminal, chain *opChain) error {
+	err := s.compileTerm()
+	if err != nil {
+		return err
+	}
+
+	if !s.precedence {
+		return nil
+	}
+
+	return s.compileOperations(precedences[op.Symbol]+1, chain)
+}
+
+// checkPrecedence warns if op binds tighter than the operator before it,
+// as the expression then means different things with and without
+// precedence. An expression is warned about only once.
+func (s *Service) checkPrecedence(op tokenizer.Terminal, chain *opChain) {
+	last := chain.last
+	chain.last = op
+
+	if chain.warned || last.Symbol == "" || precedences[op.Symbol] <= precedences[last.Symbol] {
+		return
+	}
+
+	chain.warned = true
+	s.warnings = append(s.warnings, &Error{op.Pos, fmt.Sprintf("%s after %s is evaluated differently with and without operator precedence, use parentheses", op.Symbol, last.Symbol)})
+}
+
+// compileShortCircuit compiles the right operand of && or || with the
+// value of the left operand on the stack. The right operand is evaluated
+// only if the left one does not decide the result, which is true (-1) or
+// false (0) whatever the values of the operands.
+func (s *Service) compileShortCircuit(op tokenizer.Terminal, chain *opChain) error {
+	var lblDecided, lblEnd string
+
+	if op.Symbol == "&&" {
+		lblDecided = s.vmWriter.RegisterLabel("AND_RIGHT")
+		lblEnd = s.vmWriter.RegisterLabel("AND_END")
+
+		// go on to the right operand only if the left one is true
+		s.vmWriter.WriteIf(lblDecided)
+		s.pushKeywordConstant("false")
+		s.vmWriter.WriteGoto(lblEnd)
+		s.vmWriter.WriteLabel(lblDecided)
+	} else {
+		lblDecided = s.vmWriter.RegisterLabel("OR_TRUE")
+		lblEnd = s.vmWriter.RegisterLabel("OR_END")
+
+		s.vmWriter.WriteIf(lblDecided)
+	}
+
+	err := s.compileOperand(op, chain)
+	if err != nil {
+		return err
+	}
+
+	// any value other than 0 is true
+	s.vmWriter.WritePush(vm.Const, 0)
+	s.vmWriter.WriteArithmetic(vm.Eq)
+	s.vmWriter.WriteArithmetic(vm.Not)
+
+	if op.Symbol == "||" {
+		s.vmWriter.WriteGoto(lblEnd)
+		s.vmWriter.WriteLabel(lblDecided)
+		s.pushKeywordConstant("true")
+	}
+
+	s.vmWriter.WriteLabel(lblEnd)
+	s.exprType = "boolean"
+
+	return nil
+}
+
 func (s *Service) compileReturnStatement(t tokenizer.Terminal, funcType string) error {
 	_, err := s.eatSymbol(";")
 	if err != nil {
-		s.compileExpression()
+		err = s.compileExpression()
+		if err != nil {
+			return err
+		}
 	} else {
 		s.tokenizer.Rewind(0)
 	}
@@ -464,7 +1021,7 @@ func (s *Service) compileWhileStatement(t tokenizer.Terminal) error {
 		return err
 	}
 
-	err = s.compileStatements("")
+	err = s.compileLoopBody(lblTrue, lblFalse)
 	if err != nil {
 		return err
 	}
@@ -481,6 +1038,121 @@ func (s *Service) compileWhileStatement(t tokenizer.Terminal) error {
 	return nil
 }
 
+// compileForStatement compiles a for loop of the form
+//
+//	for (let i = 0; i < n; let i = i + 1) { ... }
+//
+// into the pattern of a while loop, with the last let statement compiled
+// after the body. Each of the three parts may be left out, a missing
+// condition being true.
+func (s *Service) compileForStatement(t tokenizer.Terminal) error {
+	_, err := s.eatSymbol("(")
+	if err != nil {
+		return err
+	}
+
+	if t, err := s.eatKeyword("let"); err == nil {
+		err = s.compileLetStatement(t)
+		if err != nil {
+			return err
+		}
+	} else if _, err = s.eatSymbol(";"); err != nil {
+		return err
+	}
+
+	lblFalse := s.vmWriter.RegisterLabel("IF_FALSE")
+	lblTrue := s.vmWriter.RegisterLabel("IF_TRUE")
+	lblNext := s.vmWriter.RegisterLabel("FOR_NEXT")
+
+	s.vmWriter.WriteLabel(lblTrue)
+
+	if _, err := s.eatSymbol(";"); err != nil {
+		err = s.compileExpression()
+		if err != nil {
+			return err
+		}
+
+		_, err = s.eatSymbol(";")
+		if err != nil {
+			return err
+		}
+
+		s.vmWriter.WriteArithmetic(vm.Not)
+		s.vmWriter.WriteIf(lblFalse)
+	}
+
+	var update bytes.Buffer
+
+	if _, err := s.eatKeyword("let"); err == nil {
+		out := s.vmWriter.Divert(&update)
+		err = s.compileAssignment()
+		s.vmWriter.Divert(out)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.eatSymbol(")")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol("{")
+	if err != nil {
+		return err
+	}
+
+	err = s.compileLoopBody(lblNext, lblFalse)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol("}")
+	if err != nil {
+		return err
+	}
+
+	s.vmWriter.WriteLabel(lblNext)
+	s.vmWriter.WriteCode(update.Bytes())
+	s.vmWriter.WriteGoto(lblTrue)
+	s.vmWriter.WriteLabel(lblFalse)
+
+	return nil
+}
+
+// compileLoopBody compiles the statements of a loop. A continue statement
+// in them jumps to lblContinue and a break statement to lblBreak.
+func (s *Service) compileLoopBody(lblContinue, lblBreak string) error {
+	s.loops = append(s.loops, loop{lblContinue, lblBreak})
+	err := s.compileStatements("")
+	s.loops = s.loops[:len(s.loops)-1]
+
+	return err
+}
+
+// compileJumpStatement compiles a break or a continue statement.
+func (s *Service) compileJumpStatement(t tokenizer.Terminal) error {
+	if len(s.loops) == 0 {
+		return ErrorAt(t, "%s outside a loop", t.Keyword)
+	}
+
+	_, err := s.eatSymbol(";")
+	if err != nil {
+		return err
+	}
+
+	l := s.loops[len(s.loops)-1]
+
+	if t.Keyword == "break" {
+		s.vmWriter.WriteGoto(l.lblBreak)
+	} else {
+		s.vmWriter.WriteGoto(l.lblContinue)
+	}
+
+	return nil
+}
+
 func (s *Service) compileIfStatement(t tokenizer.Terminal) error {
 	lblFalse := s.vmWriter.RegisterLabel("IF_FALSE")
 	lblTrue := s.vmWriter.RegisterLabel("IF_TRUE")
@@ -522,77 +1194,165 @@ func (s *Service) compileIfStatement(t tokenizer.Terminal) error {
 
 	s.vmWriter.WriteLabel(lblFalse)
 
-	t, err = s.eatKeyword("else")
+	_, err = s.eatKeyword("else")
 	if err == nil {
-		t, err = s.eatSymbol("{")
+		err = s.compileElse()
 		if err != nil {
 			return err
 		}
+	}
 
-		err = s.compileStatements("")
-		if err != nil {
-			return err
-		}
+	s.vmWriter.WriteLabel(lblTrue)
 
-		t, err = s.eatSymbol("}")
-		if err != nil {
-			return err
+	return nil
+}
+
+// compileElse compiles the else block of an if statement. With the
+// extensions enabled the block may be replaced by another if statement,
+// which is compiled as if it was the only statement of the block.
+func (s *Service) compileElse() error {
+	if s.extensions() {
+		if t, err := s.eatKeyword("if"); err == nil {
+			return s.compileIfStatement(t)
 		}
 	}
 
-	s.vmWriter.WriteLabel(lblTrue)
+	_, err := s.eatSymbol("{")
+	if err != nil {
+		return err
+	}
 
-	return nil
+	err = s.compileStatements("")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol("}")
+
+	return err
 }
 
 func (s *Service) compileLetStatement(t tokenizer.Terminal) error {
+	err := s.compileAssignment()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol(";")
+
+	return err
+}
+
+// compileAssignment compiles a let statement following the keyword up to
+// the semicolon ending it. In Jack+ the assignment may be compound, as in
+// let i += 1, or an increment, as in let i++.
+func (s *Service) compileAssignment() error {
 	t, err := s.eatIdentifier()
 	if err != nil {
 		return err
 	}
 
 	e := s.symbolTable.Get(t.Identifier)
-	target := vm.MemEntry{e.Scope.ToVMMemSeg(), e.Idx}
+	if e == nil {
+		return ErrorAt(t, "undefined variable %s", t.Identifier)
+	}
+
+	s.recorder.UseVariable(t, e)
+
+	if e.Scope == symbols.Constant {
+		return ErrorAt(t, "cannot assign to constant %s", t.Identifier)
+	}
 
-	t, err = s.eatSymbol("[", "=")
+	target := vm.MemEntry{Seg: e.Scope.ToVMMemSeg(), Idx: e.Idx}
+
+	t, err = s.eatSymbol("[", "=", "+=", "-=", "*=", "|=", "++")
 	if err != nil {
-		return nil
+		return err
 	}
 
-	if t.Symbol == "[" {
+	isArray := t.Symbol == "["
+
+	if isArray {
 		s.vmWriter.WritePush(e.Scope.ToVMMemSeg(), e.Idx)
-		err = s.compileExpression()
+
+		err = s.compileSubscript()
 		if err != nil {
 			return err
 		}
 
-		t, err = s.eatSymbol("]")
+		err = s.compileChainedSubscripts()
 		if err != nil {
 			return err
 		}
 
-		t, err = s.eatSymbol("=")
+		t, err = s.eatSymbol("=", "+=", "-=", "*=", "|=", "++")
 		if err != nil {
 			return err
 		}
+	}
 
-		s.vmWriter.WriteArithmetic(vm.Add)
+	if t.Symbol == "=" {
+		s.tokenizer.Advance()
+		value := s.tokenizer.Token()
+
+		err = s.compileExpression()
+		if err != nil {
+			return err
+		}
+
+		if !isArray {
+			s.checkAssignment(value, e)
+		}
+	} else {
+		err = s.compileUpdate(t, target, isArray)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isArray {
+		// the value may use "that" itself, so the address is set only after
+		// it has been computed
+		s.vmWriter.WritePop(vm.Temp, 0)
 		s.vmWriter.WritePop(vm.Pointer, 1)
+		s.vmWriter.WritePush(vm.Temp, 0)
 
-		target = vm.MemEntry{vm.That, 0}
+		target = vm.MemEntry{Seg: vm.That, Idx: 0}
 	}
 
-	err = s.compileExpression()
-	if err != nil {
-		return err
+	s.vmWriter.WritePop(target.Seg, target.Idx)
+
+	return nil
+}
+
+// compileUpdate compiles the new value of the target of a compound
+// assignment or an increment, the operator of which is op. The address of
+// an array element is on the stack and stays there, so the index is
+// evaluated only once.
+func (s *Service) compileUpdate(op tokenizer.Terminal, target vm.MemEntry, isArray bool) error {
+	if isArray {
+		// copy the address to read the element
+		s.vmWriter.WritePop(vm.Pointer, 1)
+		s.vmWriter.WritePush(vm.Pointer, 1)
+		s.vmWriter.WritePush(vm.That, 0)
+	} else {
+		s.vmWriter.WritePush(target.Seg, target.Idx)
 	}
 
-	t, err = s.eatSymbol(";")
+	if op.Symbol == "++" {
+		s.vmWriter.WritePush(vm.Const, 1)
+		s.vmWriter.WriteArithmetic(vm.Add)
+
+		return nil
+	}
+
+	err := s.compileExpression()
 	if err != nil {
 		return err
 	}
 
-	s.vmWriter.WritePop(target.Seg, target.Idx)
+	op.Symbol = strings.TrimSuffix(op.Symbol, "=")
+	s.writeBinOp(op)
 
 	return nil
 }
@@ -608,12 +1368,17 @@ func (s *Service) compileVarDec() error {
 		return err
 	}
 
+	s.useType(tp)
+
 	id, err := s.eatIdentifier()
 	if err != nil {
 		return err
 	}
 
-	s.symbolTable.Define(id.Identifier, s.getType(tp), "local")
+	err = s.define(id, tp, "local")
+	if err != nil {
+		return err
+	}
 
 	t, err = s.eatSymbol(",", ";")
 	if err != nil {
@@ -626,7 +1391,10 @@ func (s *Service) compileVarDec() error {
 			return err
 		}
 
-		s.symbolTable.Define(id.Identifier, s.getType(tp), "local")
+		err = s.define(id, tp, "local")
+		if err != nil {
+			return err
+		}
 
 		t, err = s.eatSymbol(",", ";")
 		if err != nil {
@@ -643,12 +1411,17 @@ func (s *Service) compileParameterList() error {
 		return nil
 	}
 
+	s.useType(tp)
+
 	id, err := s.eatIdentifier()
 	if err != nil {
 		return err
 	}
 
-	s.symbolTable.Define(id.Identifier, s.getType(tp), "arg")
+	err = s.define(id, tp, "arg")
+	if err != nil {
+		return err
+	}
 
 	for {
 		_, err = s.eatSymbol(",")
@@ -661,12 +1434,40 @@ func (s *Service) compileParameterList() error {
 			return err
 		}
 
+		s.useType(tp)
+
 		id, err = s.eatIdentifier()
 		if err != nil {
 			return err
 		}
 
-		s.symbolTable.Define(id.Identifier, s.getType(tp), "arg")
+		err = s.define(id, tp, "arg")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileClassVarDecs compiles the declarations of fields, statics,
+// constants and enums at the start of a class.
+func (s *Service) compileClassVarDecs() error {
+	for s.nextIsKeyword("static", "field", "const", "enum") {
+		var err error
+
+		switch {
+		case s.nextIsKeyword("const"):
+			err = s.compileConstDec()
+		case s.nextIsKeyword("enum"):
+			err = s.compileEnumDec()
+		default:
+			err = s.compileClassVarDec()
+		}
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -683,12 +1484,17 @@ func (s *Service) compileClassVarDec() error {
 		return err
 	}
 
+	s.useType(tp)
+
 	id, err := s.eatIdentifier()
 	if err != nil {
 		return err
 	}
 
-	s.symbolTable.Define(id.Identifier, s.getType(tp), sc.Keyword)
+	err = s.define(id, tp, sc.Keyword)
+	if err != nil {
+		return err
+	}
 
 	t, err := s.eatSymbol(",", ";")
 	if err != nil {
@@ -701,7 +1507,10 @@ func (s *Service) compileClassVarDec() error {
 			return err
 		}
 
-		s.symbolTable.Define(id.Identifier, s.getType(tp), sc.Keyword)
+		err = s.define(id, tp, sc.Keyword)
+		if err != nil {
+			return err
+		}
 
 		t, err = s.eatSymbol(",", ";")
 		if err != nil {
@@ -712,13 +1521,56 @@ func (s *Service) compileClassVarDec() error {
 	return nil
 }
 
+// extensions reports whether the extensions of Jack+ are enabled.
+func (s *Service) extensions() bool {
+	return s.tokenizer.Lang() == tokenizer.JackPlus
+}
+
+// define adds the variable named by id to the symbol table.
+func (s *Service) define(id, tp tokenizer.Terminal, scope string) error {
+	e := s.symbolTable.Define(id.Identifier, s.getType(tp), scope)
+	if e == nil {
+		return ErrorAt(id, "%s already defined", id.Identifier)
+	}
+
+	s.recorder.DeclareVariable(id, e)
+
+	return nil
+}
+
+// useType records the use of a class as a type.
+func (s *Service) useType(t tokenizer.Terminal) {
+	if !t.IsOfType(tokenizer.Identifier) {
+		return
+	}
+
+	if s.isEnum(t.Identifier) {
+		s.recorder.UseEnum(t)
+		return
+	}
+
+	s.recorder.UseClass(t)
+}
+
+// nextIsKeyword reports whether the next token is one of the keywords ks
+// without consuming it.
+func (s *Service) nextIsKeyword(ks ...string) bool {
+	s.tokenizer.Advance()
+
+	return s.tokenizer.Token().IsKeyword(ks...)
+}
+
 func (s *Service) eat() tokenizer.Terminal {
 	s.tokenizer.Advance()
 	return s.tokenizer.ConsumeToken()
 }
 
-func (s *Service) eatBinOp() (tokenizer.Terminal, error) {
-	return s.eatSymbol("+", "-", "*", "/", "&", "|", "<", ">", "=")
+// nextIsSymbol reports whether the next token is one of the symbols ss
+// without consuming it.
+func (s *Service) nextIsSymbol(ss ...string) bool {
+	s.tokenizer.Advance()
+
+	return s.tokenizer.Token().IsSymbol(ss...)
 }
 
 func (s *Service) eatSymbol(ss ...string) (tokenizer.Terminal, error) {
@@ -728,7 +1580,7 @@ func (s *Service) eatSymbol(ss ...string) (tokenizer.Terminal, error) {
 		return s.tokenizer.ConsumeToken(), nil
 	}
 
-	return tokenizer.Terminal{}, fmt.Errorf("expected one of symbols %v but token was %s", ss, s.tokenizer.Token())
+	return tokenizer.Terminal{}, ErrorAt(s.tokenizer.Token(), "expected one of symbols %v but token was %s", ss, s.tokenizer.Token())
 }
 
 func (s *Service) eatKeyword(ks ...string) (tokenizer.Terminal, error) {
@@ -738,7 +1590,7 @@ func (s *Service) eatKeyword(ks ...string) (tokenizer.Terminal, error) {
 		return s.tokenizer.ConsumeToken(), nil
 	}
 
-	return tokenizer.Terminal{}, fmt.Errorf("expected one of keywords %v but token was %s", ks, s.tokenizer.Token())
+	return tokenizer.Terminal{}, ErrorAt(s.tokenizer.Token(), "expected one of keywords %v but token was %s", ks, s.tokenizer.Token())
 }
 
 func (s *Service) eatIdentifier() (tokenizer.Terminal, error) {
@@ -748,7 +1600,7 @@ func (s *Service) eatIdentifier() (tokenizer.Terminal, error) {
 		return s.tokenizer.ConsumeToken(), nil
 	}
 
-	return tokenizer.Terminal{}, fmt.Errorf("expected identifier but token was %s", s.tokenizer.Token())
+	return tokenizer.Terminal{}, ErrorAt(s.tokenizer.Token(), "expected identifier but token was %s", s.tokenizer.Token())
 }
 
 func (s *Service) eatType(ts ...string) (tokenizer.Terminal, error) {
@@ -762,7 +1614,7 @@ func (s *Service) eatType(ts ...string) (tokenizer.Terminal, error) {
 		return s.tokenizer.ConsumeToken(), nil
 	}
 
-	return tokenizer.Terminal{}, fmt.Errorf("expected a type but token was %s", s.tokenizer.Token())
+	return tokenizer.Terminal{}, ErrorAt(s.tokenizer.Token(), "expected a type but token was %s", s.tokenizer.Token())
 }
 
 func (s *Service) eatVarType() (tokenizer.Terminal, error) {
@@ -0,0 +1,124 @@
+package compilationengine_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// programs are the reference programs of the nand2tetris projects 10 and 11
+var programs = []string{
+	"Average",
+	"ComplexArrays",
+	"ConvertToBin",
+	"ExpressionLessSquare",
+	"Pong",
+	"Seven",
+	"Square",
+}
+
+func compileFile(t *testing.T, fn string) []byte {
+	t.Helper()
+
+	in, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer in.Close()
+
+	var out bytes.Buffer
+
+	c := compilationengine.New(tokenizer.New(in), vm.New(&out))
+
+	err = c.Compile()
+	if err != nil {
+		t.Fatalf("compilation of %s failed: %s", fn, err)
+	}
+
+	return out.Bytes()
+}
+
+func jackFiles(t *testing.T, program string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("testdata", program, "*.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatalf("no .jack files in testdata/%s", program)
+	}
+
+	return files
+}
+
+// checkGolden compares got with the golden file fn, or rewrites the file
+// when the tests are run with -update.
+func checkGolden(t *testing.T, fn string, got []byte) {
+	t.Helper()
+
+	if *update {
+		err := os.WriteFile(fn, got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("%s, run the tests with -update to create it", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\n%s", fn, diffLines(string(want), string(got)))
+	}
+}
+
+// diffLines describes the first line that differs between want and got.
+func diffLines(want, got string) string {
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+
+		if i < len(wl) {
+			w = wl[i]
+		}
+
+		if i < len(gl) {
+			g = gl[i]
+		}
+
+		if w != g {
+			return fmt.Sprintf("line %d: want %q, got %q", i+1, w, g)
+		}
+	}
+
+	return ""
+}
+
+func TestCompileGolden(t *testing.T) {
+	for _, program := range programs {
+		t.Run(program, func(t *testing.T) {
+			for _, fn := range jackFiles(t, program) {
+				got := compileFile(t, fn)
+				checkGolden(t, strings.TrimSuffix(fn, ".jack")+".vm", got)
+			}
+		})
+	}
+}
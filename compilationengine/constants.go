@@ -0,0 +1,281 @@
+package compilationengine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+// Constants are the constants of a program by name, grouped by the class
+// declaring them or, for the members of an enum, by the enum.
+type Constants struct {
+	groups map[string]map[string]*symbols.Entry
+	// enums are the classes declaring the enums by enum name.
+	enums map[string]string
+}
+
+// NewConstants returns an empty set of constants.
+func NewConstants() *Constants {
+	return &Constants{map[string]map[string]*symbols.Entry{}, map[string]string{}}
+}
+
+// Merge adds the constants of another class to c. It reports an enum
+// named like an enum of another class or like a class, as their constants
+// would be indistinguishable.
+func (c *Constants) Merge(o *Constants) error {
+	for name := range o.groups {
+		if _, exists := c.groups[name]; !exists {
+			continue
+		}
+
+		class, enum := c.enums[name], o.enums[name]
+
+		switch {
+		case class != "" && enum != "":
+			return fmt.Errorf("enum %s declared in both %s and %s", name, class, enum)
+		case class != "":
+			return fmt.Errorf("enum %s of %s has the name of a class", name, class)
+		case enum != "":
+			return fmt.Errorf("enum %s of %s has the name of a class", name, enum)
+		default:
+			return fmt.Errorf("class %s declared twice", name)
+		}
+	}
+
+	for name, g := range o.groups {
+		c.groups[name] = g
+	}
+
+	for name, class := range o.enums {
+		c.enums[name] = class
+	}
+
+	return nil
+}
+
+// SetConstants sets the constants of the classes of the program, which the
+// compiled class can use as Class.NAME.
+func (s *Service) SetConstants(c *Constants) {
+	s.constants = c
+}
+
+// ScanConstants reads the declarations at the start of the class read by t
+// without compiling its subroutines. It returns the constants of the class
+// and the members of its enums.
+func ScanConstants(t *tokenizer.Service) (*Constants, error) {
+	s := New(t, vm.New(io.Discard))
+	cs := NewConstants()
+
+	_, err := s.eatKeyword("class")
+	if err != nil {
+		return cs, err
+	}
+
+	name, err := s.eatIdentifier()
+	if err != nil {
+		return cs, err
+	}
+
+	s.className = name.Identifier
+
+	_, err = s.eatSymbol("{")
+	if err != nil {
+		return cs, err
+	}
+
+	err = s.compileClassVarDecs()
+
+	cs.groups[s.className] = map[string]*symbols.Entry{}
+
+	for enum := range s.enums {
+		cs.groups[enum] = map[string]*symbols.Entry{}
+		cs.enums[enum] = s.className
+	}
+
+	for name, e := range s.symbolTable.Constants() {
+		if enum, member, ok := strings.Cut(name, "."); ok {
+			cs.groups[enum][member] = e
+		} else {
+			cs.groups[s.className][name] = e
+		}
+	}
+
+	return cs, err
+}
+
+// compileConstDec compiles the declaration of a class constant of Jack+,
+// whose value is inlined wherever the constant is used.
+func (s *Service) compileConstDec() error {
+	_, err := s.eatKeyword("const")
+	if err != nil {
+		return err
+	}
+
+	tp, err := s.eatKeyword("int", "char", "boolean")
+	if err != nil {
+		return err
+	}
+
+	id, err := s.eatIdentifier()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.eatSymbol("=")
+	if err != nil {
+		return err
+	}
+
+	v, err := s.constantValue()
+	if err != nil {
+		return err
+	}
+
+	err = s.define(id, tp, "const")
+	if err != nil {
+		return err
+	}
+
+	s.symbolTable.Get(id.Identifier).Value = v
+
+	_, err = s.eatSymbol(";")
+
+	return err
+}
+
+// compileEnumDec compiles the declaration of an enum of Jack+. The members
+// are constants of the type of the enum numbered from 0, kept in the symbol
+// table as Enum.MEMBER.
+func (s *Service) compileEnumDec() error {
+	_, err := s.eatKeyword("enum")
+	if err != nil {
+		return err
+	}
+
+	name, err := s.eatIdentifier()
+	if err != nil {
+		return err
+	}
+
+	if s.enums[name.Identifier] || name.Identifier == s.className {
+		return ErrorAt(name, "%s already defined", name.Identifier)
+	}
+
+	s.enums[name.Identifier] = true
+	s.recorder.DeclareEnum(name)
+
+	_, err = s.eatSymbol("{")
+	if err != nil {
+		return err
+	}
+
+	for v := 0; ; v++ {
+		id, err := s.eatIdentifier()
+		if err != nil {
+			return err
+		}
+
+		e := s.symbolTable.Define(name.Identifier+"."+id.Identifier, name.Identifier, "const")
+		if e == nil {
+			return ErrorAt(id, "%s.%s already defined", name.Identifier, id.Identifier)
+		}
+
+		e.Value = v
+		s.recorder.DeclareVariable(id, e)
+
+		t, err := s.eatSymbol(",", "}")
+		if err != nil {
+			return err
+		}
+
+		if t.Symbol == "}" {
+			return nil
+		}
+	}
+}
+
+// isEnum reports whether the type tp is an enum of the class or of the
+// other classes of the program.
+func (s *Service) isEnum(tp string) bool {
+	return s.enums[tp] || s.constants.enums[tp] != ""
+}
+
+// constantValue compiles the value of a constant declaration: an integer
+// constant, possibly negated, a character constant, true or false.
+func (s *Service) constantValue() (int, error) {
+	t := s.eat()
+
+	if t.IsSymbol("-") {
+		t = s.eat()
+		if t.IsOfType(tokenizer.IntegerConstant) {
+			return integerValue(t, true)
+		}
+	} else {
+		switch {
+		case t.IsOfType(tokenizer.IntegerConstant):
+			return integerValue(t, false)
+		case t.IsOfType(tokenizer.CharConstant):
+			return int(t.CharConstant[0]), nil
+		case t.IsKeyword("true"):
+			return -1, nil
+		case t.IsKeyword("false"):
+			return 0, nil
+		}
+	}
+
+	return 0, ErrorAt(t, "expected a constant value but token was %s", t)
+}
+
+// compileClassConstant compiles the use of a constant of class following
+// the dot after the class name. It reports false, leaving the tokens after
+// the class name unread, if the dot starts a subroutine call instead.
+func (s *Service) compileClassConstant(class tokenizer.Terminal) (bool, error) {
+	name, err := s.eatIdentifier()
+	if err != nil {
+		return false, err
+	}
+
+	if s.nextIsSymbol("(") {
+		s.tokenizer.Rewind(2)
+		return false, nil
+	}
+
+	var e *symbols.Entry
+
+	switch {
+	case class.Identifier == s.className:
+		e = s.symbolTable.Constants()[name.Identifier]
+	case s.enums[class.Identifier]:
+		e = s.symbolTable.Get(class.Identifier + "." + name.Identifier)
+	default:
+		e = s.constants.groups[class.Identifier][name.Identifier]
+	}
+
+	if e == nil || e.Scope != symbols.Constant {
+		return false, ErrorAt(name, "undefined constant %s.%s", class.Identifier, name.Identifier)
+	}
+
+	switch {
+	case class.Identifier == s.className:
+		s.recorder.UseClass(class)
+		s.recorder.UseVariable(name, e)
+	case s.enums[class.Identifier]:
+		s.recorder.UseEnum(class)
+		s.recorder.UseVariable(name, e)
+	case s.isEnum(class.Identifier):
+		s.recorder.UseEnum(class)
+		s.recorder.UseConstant(name, class.Identifier)
+	default:
+		s.recorder.UseClass(class)
+		s.recorder.UseConstant(name, class.Identifier)
+	}
+
+	s.pushInteger(e.Value)
+	s.exprType = e.Type
+
+	return true, nil
+}
@@ -0,0 +1,28 @@
+package compilationengine
+
+import (
+	"fmt"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+// Error is an error at a position of the source, reported by the compiler
+// or by the formatter.
+type Error struct {
+	Pos tokenizer.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorAt returns an error at the position of t. Errors reported by the
+// tokenizer take precedence over the message.
+func ErrorAt(t tokenizer.Terminal, format string, a ...interface{}) error {
+	if t.IsOfType(tokenizer.Error) {
+		return &Error{t.Pos, t.Err}
+	}
+
+	return &Error{t.Pos, fmt.Sprintf(format, a...)}
+}
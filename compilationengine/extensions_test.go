@@ -0,0 +1,871 @@
+package compilationengine_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm/interpreter"
+)
+
+// compileSource compiles the class src written in the language l.
+func compileSource(src string, l tokenizer.Lang) ([]byte, error) {
+	var out bytes.Buffer
+
+	tk := tokenizer.New(strings.NewReader(src))
+	tk.SetLang(l)
+
+	err := compilationengine.New(tk, vm.New(&out)).Compile()
+
+	return out.Bytes(), err
+}
+
+// runMain compiles the class Main written in Jack+, runs it and returns
+// what it printed.
+func runMain(t *testing.T, src string) string {
+	t.Helper()
+
+	code, err := compileSource(src, tokenizer.JackPlus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runCode(t, code)
+}
+
+// runCode runs the compiled class Main and returns what it printed.
+func runCode(t *testing.T, code []byte) string {
+	t.Helper()
+
+	m := interpreter.New()
+	m.SetMaxSteps(maxSteps)
+
+	if err := m.Load("Main", bytes.NewReader(code)); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, m)
+
+	return m.Output()
+}
+
+// checkRejected checks that plain Jack does not accept src.
+func checkRejected(t *testing.T, src string) {
+	t.Helper()
+
+	if _, err := compileSource(src, tokenizer.Jack); err == nil {
+		t.Errorf("plain Jack accepted\n%s", src)
+	}
+}
+
+// mainWith returns the class Main whose function main runs stmts before
+// returning.
+func mainWith(stmts string) string {
+	return "class Main {\n    function void main() {\n        " + stmts + "\n        return;\n    }\n}\n"
+}
+
+// checkError checks that Jack+ rejects src with the error want, given as
+// line:col: message.
+func checkError(t *testing.T, src, want string) {
+	t.Helper()
+
+	_, err := compileSource(src, tokenizer.JackPlus)
+
+	var ce *compilationengine.Error
+	if !errors.As(err, &ce) || ce.Error() != want {
+		t.Errorf("want error %s, got %v\n%s", want, err, src)
+	}
+}
+
+const elseIf = `class Main {
+    function int classify(int k) {
+        if (k = 130) {
+            return 1;
+        } else if (k = 131) {
+            return 2;
+        } else if (k = 132) {
+            return 3;
+        } else {
+            return 0;
+        }
+    }
+
+    function void main() {
+        do Output.printInt(Main.classify(130));
+        do Output.printInt(Main.classify(131));
+        do Output.printInt(Main.classify(132));
+        do Output.printInt(Main.classify(133));
+        return;
+    }
+}
+`
+
+const nestedElse = `class Main {
+    function int classify(int k) {
+        if (k = 130) {
+            return 1;
+        } else {
+            if (k = 131) {
+                return 2;
+            } else {
+                if (k = 132) {
+                    return 3;
+                } else {
+                    return 0;
+                }
+            }
+        }
+    }
+
+    function void main() {
+        do Output.printInt(Main.classify(130));
+        do Output.printInt(Main.classify(131));
+        do Output.printInt(Main.classify(132));
+        do Output.printInt(Main.classify(133));
+        return;
+    }
+}
+`
+
+func TestElseIf(t *testing.T) {
+	got, err := compileSource(elseIf, tokenizer.JackPlus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := compileSource(nestedElse, tokenizer.Jack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("else if differs from the nested form:\n%s", diffLines(string(want), string(got)))
+	}
+
+	if out := runMain(t, elseIf); out != "1230" {
+		t.Errorf("want output 1230, got %q", out)
+	}
+
+	checkRejected(t, elseIf)
+}
+
+const breakContinue = `class Main {
+    function void main() {
+        var int i, j;
+        let i = 0;
+        while (true) {
+            let i = i + 1;
+            if (i > 9) {
+                break;
+            }
+            if ((i & 1) = 1) {
+                continue;
+            }
+            let j = 0;
+            while (true) {
+                if (j = i) {
+                    break;
+                }
+                let j = j + 1;
+            }
+            do Output.printInt(j);
+        }
+        do Output.printInt(i);
+        return;
+    }
+}
+`
+
+func TestBreakContinue(t *testing.T) {
+	if out := runMain(t, breakContinue); out != "246810" {
+		t.Errorf("want output 246810, got %q", out)
+	}
+
+	checkRejected(t, breakContinue)
+}
+
+func TestJumpOutsideLoop(t *testing.T) {
+	for _, stmt := range []string{"break", "continue"} {
+		src := "class Main {\n    function void main() {\n        if (true) {\n            " + stmt + ";\n        }\n        return;\n    }\n}\n"
+
+		_, err := compileSource(src, tokenizer.JackPlus)
+
+		var ce *compilationengine.Error
+		if !errors.As(err, &ce) || ce.Pos.Line != 4 || ce.Msg != stmt+" outside a loop" {
+			t.Errorf("got error %v for %s outside a loop", err, stmt)
+		}
+	}
+}
+
+const forLoops = `class Main {
+    function void main() {
+        var Array a;
+        var int i, j, sum;
+        let a = Array.new(10);
+        for (let i = 0; i < 10; let i = i + 1) {
+            let a[i] = i * i;
+        }
+        // continue runs the last part of the loop
+        for (let i = 0; i < 10; let i = i + 1) {
+            if ((i & 1) = 1) {
+                continue;
+            }
+            let sum = sum + a[i];
+        }
+        do Output.printInt(sum);
+        do Output.printChar(32);
+        for (let i = 0; ; let i = i + 1) {
+            for (let j = 0; j < i; let j = j + 1) {
+                if (j = 2) {
+                    break;
+                }
+                do Output.printInt(j);
+            }
+            if (i = 4) {
+                break;
+            }
+        }
+        do Output.printChar(32);
+        let i = 3;
+        for (; i > 0;) {
+            do Output.printInt(i);
+            let i = i - 1;
+        }
+        return;
+    }
+}
+`
+
+func TestForLoops(t *testing.T) {
+	// 0 + 4 + 16 + 36 + 64
+	if out := runMain(t, forLoops); out != "120 0010101 321" {
+		t.Errorf("want output 120 0010101 321, got %q", out)
+	}
+
+	checkRejected(t, forLoops)
+}
+
+const shortCircuit = `class Main {
+    function boolean trace(int v) {
+        do Output.printChar(v);
+        return true;
+    }
+
+    function void main() {
+        var Array a;
+        var int i;
+        let a = Array.new(2);
+        let a[0] = 7;
+        let a[1] = 0;
+        let i = 0;
+        while ((i < 2) && ~(a[i] = 0)) {
+            let i = i + 1;
+        }
+        do Output.printInt(i);
+        do Output.printInt(false && Main.trace(65));
+        do Output.printInt(true || Main.trace(66));
+        do Output.printInt(5 && Main.trace(67));
+        do Output.printInt(0 || 7);
+        do Output.printInt(0 || 0);
+        do Output.printInt((1 = 2) || (2 = 2) && (3 = 4));
+        return;
+    }
+}
+`
+
+func TestShortCircuit(t *testing.T) {
+	// 1 is where the loop stopped, C the only operand traced
+	if out := runMain(t, shortCircuit); out != "10-1C-1-100" {
+		t.Errorf("want output 10-1C-1-100, got %q", out)
+	}
+
+	checkRejected(t, shortCircuit)
+}
+
+const charLiterals = `class Main {
+    function void main() {
+        do Output.printChar('a');
+        do Output.printInt('\n');
+        do Output.printInt('\x81');
+        do Output.printChar('\'');
+        do Output.printString("say \"hi\" \\ \x41");
+        return;
+    }
+}
+`
+
+func TestCharLiterals(t *testing.T) {
+	if out := runMain(t, charLiterals); out != `a128129'say "hi" \ A` {
+		t.Errorf(`want output a128129'say "hi" \ A, got %q`, out)
+	}
+
+	checkRejected(t, charLiterals)
+}
+
+func TestBadEscapes(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{`"ab\qc"`, `3:31: unknown escape \q`},
+		{`"\n\x4g"`, `3:31: unknown escape \x4`},
+		{`'\'`, "3:28: unterminated character constant"},
+		{`''`, "3:28: character constant must be a single character"},
+		{`'ab'`, "3:28: character constant must be a single character"},
+	}
+
+	for _, tt := range tests {
+		checkError(t, mainWith("do Output.printInt("+tt.term+");"), tt.want)
+	}
+}
+
+const integers = `class Main {
+    function void main() {
+        do Output.printInt(0x4000);
+        do Output.printChar(32);
+        do Output.printInt(0b1010 + 1_000);
+        do Output.printChar(32);
+        do Output.printInt(-32768);
+        do Output.printChar(32);
+        do Output.printInt(0xFFFF);
+        do Output.printChar(32);
+        do Output.printInt(-0x10 - 0x8000);
+        return;
+    }
+}
+`
+
+func TestIntegerConstants(t *testing.T) {
+	if out := runMain(t, integers); out != "16384 1010 -32768 -1 32752" {
+		t.Errorf("want output 16384 1010 -32768 -1 32752, got %q", out)
+	}
+
+	code, err := compileSource(integers, tokenizer.JackPlus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"push constant 16384\n", "push constant 32767\nnot\n", "push constant 1\nneg\n"} {
+		if !bytes.Contains(code, []byte(want)) {
+			t.Errorf("no %q in\n%s", want, code)
+		}
+	}
+
+	checkRejected(t, integers)
+}
+
+func TestBadIntegerConstants(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"32768", "3:28: integer constant 32768 out of 16 bits, only -32768 is valid"},
+		{"-32769", "3:29: integer constant 32769 out of 16 bits"},
+		{"0x1_0000", "3:28: integer constant 0x1_0000 out of 16 bits"},
+		{"99999999999", "3:28: integer constant 99999999999 out of 16 bits"},
+		{"1__0", "3:28: invalid integer constant 1__0"},
+		{"0x", "3:28: invalid integer constant 0x"},
+		{"0b102", "3:28: invalid integer constant 0b102"},
+		{"12ab", "3:28: invalid integer constant 12ab"},
+	}
+
+	for _, tt := range tests {
+		checkError(t, mainWith("do Output.printInt("+tt.term+");"), tt.want)
+	}
+}
+
+const game = `class Game {
+    const int SPEED = 3;
+    const int MIN = -32768;
+    const char KEY = 'q';
+    const boolean DEBUG = true;
+
+    function int speed() {
+        return SPEED * 2;
+    }
+}
+`
+
+const useConstants = `class Main {
+    const int SPEED = 10;
+
+    function void main() {
+        var int SPEED2;
+        let SPEED2 = Main.SPEED + SPEED;
+        do Output.printInt(SPEED2);
+        do Output.printChar(32);
+        do Output.printInt(Game.SPEED + Game.speed());
+        do Output.printChar(32);
+        do Output.printInt(Game.MIN);
+        do Output.printChar(Game.KEY);
+        do Output.printInt(Game.DEBUG);
+        return;
+    }
+}
+`
+
+// compileProgram compiles the Jack+ classes srcs, strictly if strict is
+// set, and loads them in a machine. It returns the machine and the
+// warnings of the compilation.
+func compileProgram(t *testing.T, strict bool, srcs ...string) (*interpreter.Machine, []*compilationengine.Error) {
+	t.Helper()
+
+	consts := compilationengine.NewConstants()
+
+	for _, src := range srcs {
+		tk := tokenizer.New(strings.NewReader(src))
+		tk.SetLang(tokenizer.JackPlus)
+
+		cs, err := compilationengine.ScanConstants(tk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := consts.Merge(cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := interpreter.New()
+	m.SetMaxSteps(maxSteps)
+
+	var warnings []*compilationengine.Error
+
+	for _, src := range srcs {
+		var out bytes.Buffer
+
+		tk := tokenizer.New(strings.NewReader(src))
+		tk.SetLang(tokenizer.JackPlus)
+
+		c := compilationengine.New(tk, vm.New(&out))
+		c.SetConstants(consts)
+		c.SetStrict(strict)
+
+		if err := c.Compile(); err != nil {
+			t.Fatal(err)
+		}
+
+		warnings = append(warnings, c.Warnings()...)
+
+		if bytes.Contains(out.Bytes(), []byte("static")) {
+			t.Errorf("constants in static memory:\n%s", out.Bytes())
+		}
+
+		if err := m.Load(strings.Fields(src)[1], &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m, warnings
+}
+
+func TestConstants(t *testing.T) {
+	m, _ := compileProgram(t, false, game, useConstants)
+	run(t, m)
+
+	if out := m.Output(); out != "20 9 -32768q-1" {
+		t.Errorf("want output 20 9 -32768q-1, got %q", out)
+	}
+
+	checkRejected(t, game)
+}
+
+func TestBadConstants(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"class Main {\n    const int X = 1;\n    function void main() {\n        let X = 2;\n        return;\n    }\n}\n", "4:13: cannot assign to constant X"},
+		{mainWith("do Output.printInt(Game.NOPE);"), "3:33: undefined constant Game.NOPE"},
+		{"class Main {\n    const int X = Y;\n}\n", "2:19: expected a constant value but token was {Type:identifier Identifier:Y}"},
+		{"class Main {\n    const Array X = 1;\n}\n", "2:11: expected one of keywords [int char boolean] but token was {Type:identifier Identifier:Array}"},
+		{"class Main {\n    const int X = 1;\n    const int X = 2;\n}\n", "3:15: X already defined"},
+		{"class Main {\n    enum E { A, B, A }\n}\n", "2:20: E.A already defined"},
+		{"class Main {\n    enum E { A }\n    enum E { B }\n}\n", "3:10: E already defined"},
+		{"class Main {\n    enum E { A }\n    function void main() {\n        do Output.printInt(E.B);\n        return;\n    }\n}\n", "4:30: undefined constant E.B"},
+	}
+
+	for _, tt := range tests {
+		checkError(t, tt.src, tt.want)
+	}
+}
+
+const directions = `class Compass {
+    enum Direction { NORTH, EAST, SOUTH, WEST }
+
+    function Direction turn(Direction d) {
+        if (d = Direction.WEST) {
+            return Direction.NORTH;
+        }
+        return d + 1;
+    }
+}
+`
+
+const useEnums = `class Main {
+    enum Light { RED, GREEN }
+
+    function void main() {
+        var Direction d;
+        var Light l;
+        let d = Direction.WEST;
+        let d = Compass.turn(d);
+        do Output.printInt(d);
+        let d = Compass.turn(Direction.EAST);
+        do Output.printInt(d);
+        let l = Light.GREEN;
+        do Output.printInt(l);
+        let d = 3;
+        let l = Direction.SOUTH;
+        let d = (Direction.NORTH);
+        return;
+    }
+}
+`
+
+func TestEnums(t *testing.T) {
+	m, warnings := compileProgram(t, false, directions, useEnums)
+	run(t, m)
+
+	if out := m.Output(); out != "021" {
+		t.Errorf("want output 021, got %q", out)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("warnings without strict mode: %v", warnings)
+	}
+
+	// return d + 1 is not checked, only assignments are
+	_, warnings = compileProgram(t, true, directions, useEnums)
+
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.Error())
+	}
+
+	want := "14:17: int assigned to Direction d, 15:17: Direction assigned to Light l"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("want warnings %s, got %s", want, strings.Join(got, ", "))
+	}
+
+	checkRejected(t, directions)
+}
+
+func TestEnumClashes(t *testing.T) {
+	tests := []struct {
+		srcs []string
+		msg  string
+	}{
+		{[]string{"class A { enum E { X } }", "class B { enum E { Y } }"}, "enum E declared in both A and B"},
+		{[]string{"class A { enum B { X } }", "class B { }"}, "enum B of A has the name of a class"},
+		{[]string{"class B { }", "class A { enum B { X } }"}, "enum B of A has the name of a class"},
+		{[]string{"class A { }", "class A { }"}, "class A declared twice"},
+	}
+
+	for _, tt := range tests {
+		consts := compilationengine.NewConstants()
+
+		var err error
+
+		for _, src := range tt.srcs {
+			tk := tokenizer.New(strings.NewReader(src))
+			tk.SetLang(tokenizer.JackPlus)
+
+			cs, scanErr := compilationengine.ScanConstants(tk)
+			if scanErr != nil {
+				t.Fatal(scanErr)
+			}
+
+			err = consts.Merge(cs)
+		}
+
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("want error %s, got %v", tt.msg, err)
+		}
+	}
+}
+
+const compound = `class Main {
+    static int calls;
+
+    function int index(int i) {
+        let calls++;
+        return i;
+    }
+
+    function void main() {
+        var Array a;
+        var int i, s;
+        let a = Array.new(2);
+        let a[0] = 1;
+        let a[1] = 10;
+        let a[Main.index(0)] += a[1] * 2;
+        let a[Main.index(1)]++;
+        do Output.printInt(a[0]);
+        do Output.printChar(32);
+        do Output.printInt(a[1]);
+        do Output.printChar(32);
+        do Output.printInt(calls);
+        do Output.printChar(32);
+        for (let i = 0; i < 4; let i++) {
+            let s += i;
+        }
+        let s *= 3 + 1;
+        let s -= 4;
+        let s |= 1;
+        do Output.printInt(s);
+        return;
+    }
+}
+`
+
+func TestCompoundAssignment(t *testing.T) {
+	// s is (0 + 1 + 2 + 3) * 4 - 4 | 1
+	if out := runMain(t, compound); out != "21 11 2 21" {
+		t.Errorf("want output 21 11 2 21, got %q", out)
+	}
+
+	checkRejected(t, compound)
+}
+
+const grids = `class Main {
+    function void main() {
+        var Array grid, ix;
+        var int x, y;
+        let ix = Array.new(3);
+        let grid = Array.new(3);
+        for (let y = 0; y < 3; let y++) {
+            let ix[y] = y;
+        }
+        for (let y = 0; y < 3; let y++) {
+            let grid[y] = Array.new(3);
+            for (let x = 0; x < 3; let x++) {
+                let grid[ix[y]][ix[x]] = (y * 10) + x;
+            }
+        }
+        let grid[ix[1]][grid[0][2]] += grid[2][grid[0][1]];
+        do Output.printInt(grid[1][2]);
+        do Output.printChar(32);
+        do Output.printInt(grid[grid[0][2]][ix[grid[0][1]]]);
+        return;
+    }
+}
+`
+
+func TestChainedSubscripts(t *testing.T) {
+	// grid[1][2] is 12 + 21
+	if out := runMain(t, grids); out != "33 21" {
+		t.Errorf("want output 33 21, got %q", out)
+	}
+
+	checkRejected(t, grids)
+}
+
+const literals = `class Main {
+    function void main() {
+        var Array a, b;
+        let b = Array.from("\x01\x03\x07");
+        let a = [b[2], [10, -20, b], 'A' + 1];
+        do Output.printInt(a[0]);
+        do Output.printChar(32);
+        do Output.printInt(a[1][1] + a[1][0]);
+        do Output.printChar(32);
+        do Output.printInt(a[1][2][1]);
+        do Output.printChar(32);
+        do Output.printChar(a[2]);
+        return;
+    }
+}
+`
+
+func TestArrayLiterals(t *testing.T) {
+	if out := runMain(t, literals); out != "7 -10 3 B" {
+		t.Errorf("want output 7 -10 3 B, got %q", out)
+	}
+
+	checkRejected(t, literals)
+}
+
+func TestBadArrayLiterals(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"[]", "4:17: empty array literal"},
+		{"[1, ]", "4:21: expected a term but token was {Type:symbol Symbol:]}"},
+		{"Array.from(\"\")", "4:28: expected a string constant of at least one character but token was {Type:stringConstant}"},
+		{"Array.from(1)", "4:28: expected a string constant of at least one character but token was {Type:integerConstant Integer:1}"},
+	}
+
+	for _, tt := range tests {
+		checkError(t, mainWith("var Array a;\n        let a = "+tt.term+";"), tt.want)
+	}
+}
+
+const operators = `class Main {
+    function void show(int x) {
+        do Output.printInt(x);
+        do Output.printChar(32);
+        return;
+    }
+
+    function void main() {
+        var int i, n;
+        do Main.show(17 % 5);
+        do Main.show(-17 % 5);
+        do Main.show(12 ^ 10);
+        do Main.show(-1 ^ 0x00FF);
+        do Main.show(1 << 15);
+        do Main.show(3 << 16);
+        do Main.show(-16 >> 2);
+        do Main.show(0x7FFF >> 14);
+        do Main.show(-1 >> 20);
+        let n = 3;
+        for (let i = -1; i < 17; let i += 6) {
+            do Main.show((n << i) >> i);
+        }
+        return;
+    }
+}
+`
+
+func TestOperators(t *testing.T) {
+	// shifting by -1 and by 0 leaves the value
+	if out := runMain(t, operators); out != "2 -2 6 -256 -32768 0 -4 1 -1 3 3 3 " {
+		t.Errorf("want output 2 -2 6 -256 -32768 0 -4 1 -1 3 3 3 , got %q", out)
+	}
+
+	checkRejected(t, operators)
+}
+
+const comparisons = `class Main {
+    function void main() {
+        var int i;
+        for (let i = -1; i <= 1; let i++) {
+            do Output.printInt(i <= 0);
+            do Output.printInt(i >= 0);
+            do Output.printInt(i != 0);
+            do Output.printChar(32);
+        }
+        do Output.printInt((1 >= 1) & (-32768 <= 32767) & ~(0 != 0));
+        return;
+    }
+}
+`
+
+func TestComparisons(t *testing.T) {
+	if out := runMain(t, comparisons); out != "-10-1 -1-10 0-1-1 -1" {
+		t.Errorf("want output -10-1 -1-10 0-1-1 -1, got %q", out)
+	}
+
+	checkRejected(t, comparisons)
+}
+
+const conditionals = `class Main {
+    function int sign(int x) {
+        return x < 0 ? -1 : x = 0 ? 0 : 1;
+    }
+
+    function void main() {
+        var int i;
+        var Array a;
+        let a = [5, 0];
+        for (let i = -3; i < 6; let i += 3) {
+            do Output.printInt(Main.sign(i));
+        }
+        do Output.printChar(32);
+        do Output.printInt(a[0] ? a[1] ? 1 : 2 : 3);
+        do Output.printInt((a[1] ? 1 : 2) + 1);
+        do Output.printInt(a[(a[1] = 0) ? 1 : 0]);
+        do Output.printChar(32);
+        do Output.printString(true ? "yes" : Main.fail());
+        return;
+    }
+
+    function String fail() {
+        do Output.printString("evaluated");
+        return "no";
+    }
+}
+`
+
+func TestConditionals(t *testing.T) {
+	// a[0] is true, though not -1
+	if out := runMain(t, conditionals); out != "-101 230 yes" {
+		t.Errorf("want output -101 230 yes, got %q", out)
+	}
+
+	checkRejected(t, conditionals)
+}
+
+func TestBadConditionals(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 ? 2", "4:22: expected one of symbols [:] but token was {Type:symbol Symbol:;}"},
+		{"1 ? : 2", "4:21: expected a term but token was {Type:symbol Symbol::}"},
+		{"1 : 2", "4:19: expected one of symbols [;] but token was {Type:symbol Symbol::}"},
+	}
+
+	for _, tt := range tests {
+		checkError(t, mainWith("var int a;\n        let a = "+tt.expr+";"), tt.want)
+	}
+}
+
+const precedence = `class Main {
+    function void main() {
+        do Output.printInt(1 + 2 * 3);
+        do Output.printChar(32);
+        do Output.printInt(2 * 3 + 1);
+        do Output.printChar(32);
+        do Output.printInt(2 & 1 = 1);
+        do Output.printChar(32);
+        do Output.printInt(8 - 2 - 1 + 10 / 5);
+        do Output.printChar(32);
+        do Output.printInt((1 + 2) * 3 = 9);
+        do Output.printChar(32);
+        do Output.printInt(~(2 | 1 = 1));
+        return;
+    }
+}
+`
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		precedence bool
+		want       string
+	}{
+		{false, "9 7 0 3 -1 -1"},
+		{true, "7 7 2 7 -1 0"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+
+		c := compilationengine.New(tokenizer.New(strings.NewReader(precedence)), vm.New(&out))
+		c.SetPrecedence(tt.precedence)
+
+		if err := c.Compile(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := runCode(t, out.Bytes()); got != tt.want {
+			t.Errorf("precedence %t: want output %s, got %q", tt.precedence, tt.want, got)
+		}
+
+		var warnings []string
+		for _, w := range c.Warnings() {
+			warnings = append(warnings, w.Pos.String())
+		}
+
+		// the same in both modes, none where the parentheses decide
+		if got := strings.Join(warnings, " "); got != "3:34 7:34 9:43 13:36" {
+			t.Errorf("precedence %t: want warnings at 3:34 7:34 9:43 13:36, got %s", tt.precedence, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package compilationengine_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+func FuzzCompile(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.jack"))
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, fn := range files {
+		src, err := os.ReadFile(fn)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		for _, l := range []tokenizer.Lang{tokenizer.Jack, tokenizer.JackPlus} {
+			checkCompile(t, in, l)
+		}
+	})
+}
+
+// checkCompile compiles in as the language l and fails the test if the
+// compilation does not terminate or gives an error outside of the input.
+func checkCompile(t *testing.T, in []byte, l tokenizer.Lang) {
+	done := make(chan error, 1)
+
+	go func() {
+		tk := tokenizer.New(bytes.NewReader(in))
+		tk.SetLang(l)
+		done <- compilationengine.New(tk, vm.New(io.Discard)).Compile()
+	}()
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: compilation did not terminate", l)
+	}
+
+	var compErr *compilationengine.Error
+	if errors.As(err, &compErr) {
+		if compErr.Pos.Offset < 0 || compErr.Pos.Offset > len(in) {
+			t.Fatalf("%s: error %q outside of input of length %d", l, err, len(in))
+		}
+	} else if err != nil {
+		t.Fatalf("%s: error without a position: %s", l, err)
+	}
+}
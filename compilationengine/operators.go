@@ -0,0 +1,146 @@
+package compilationengine
+
+import "github.com/pqkallio/nand2tetris-jack-compiler/vm"
+
+// The operators of Jack+ below have no VM command of their own. They are
+// lowered to VM code working on the two operands on the stack, which are
+// first moved to the temp segment. A temp value is never read after a
+// call, as the called function may use the temp segment itself.
+
+// writeModulo writes x % y as x - x / y * y. The result has the sign of x,
+// as Math.divide rounds towards zero.
+func (s *Service) writeModulo() {
+	s.vmWriter.WritePop(vm.Temp, 1)
+	s.vmWriter.WritePop(vm.Temp, 0)
+
+	// x y x y
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePush(vm.Temp, 1)
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePush(vm.Temp, 1)
+
+	s.vmWriter.WriteCall("Math.divide", 2)
+	s.vmWriter.WriteCall("Math.multiply", 2)
+	s.vmWriter.WriteArithmetic(vm.Sub)
+}
+
+// writeXor writes x ^ y as (x | y) & ~(x & y).
+func (s *Service) writeXor() {
+	s.vmWriter.WritePop(vm.Temp, 1)
+	s.vmWriter.WritePop(vm.Temp, 0)
+
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePush(vm.Temp, 1)
+	s.vmWriter.WriteArithmetic(vm.Or)
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePush(vm.Temp, 1)
+	s.vmWriter.WriteArithmetic(vm.And)
+	s.vmWriter.WriteArithmetic(vm.Not)
+	s.vmWriter.WriteArithmetic(vm.And)
+}
+
+// writeShiftLeft writes x << n by doubling x n times. Shifting by 16 or
+// more gives 0.
+func (s *Service) writeShiftLeft() {
+	s.vmWriter.WritePop(vm.Temp, 1)
+	s.vmWriter.WritePop(vm.Temp, 0)
+
+	s.writeRepeat("SHL", 1, func() {
+		s.writeDouble(0)
+	})
+
+	s.vmWriter.WritePush(vm.Temp, 0)
+}
+
+// writeShiftRight writes x >> n, an arithmetic shift: the sign bit of x is
+// copied to the bits shifted in, so -1 >> n is -1. Each bit of the result
+// is copied from the bit n places higher in x, or from the sign bit where
+// that is past the top bit.
+func (s *Service) writeShiftRight() {
+	s.vmWriter.WritePop(vm.Temp, 1)
+	s.vmWriter.WritePop(vm.Temp, 0)
+
+	// temp 2 selects the bit of x to copy, starting n places up
+	s.vmWriter.WritePush(vm.Const, 1)
+	s.vmWriter.WritePop(vm.Temp, 2)
+	s.writeRepeat("SHR", 1, func() {
+		s.writeDoubleToTop(2)
+	})
+
+	// temp 1 selects the bit of the result in temp 3, until it is shifted
+	// out at the top
+	s.vmWriter.WritePush(vm.Const, 1)
+	s.vmWriter.WritePop(vm.Temp, 1)
+	s.vmWriter.WritePush(vm.Const, 0)
+	s.vmWriter.WritePop(vm.Temp, 3)
+
+	lblBit := s.vmWriter.RegisterLabel("SHR_BIT")
+	s.vmWriter.WriteLabel(lblBit)
+
+	// r | (bit & (x & from != 0))
+	s.vmWriter.WritePush(vm.Temp, 3)
+	s.vmWriter.WritePush(vm.Temp, 0)
+	s.vmWriter.WritePush(vm.Temp, 2)
+	s.vmWriter.WriteArithmetic(vm.And)
+	s.vmWriter.WritePush(vm.Const, 0)
+	s.vmWriter.WriteArithmetic(vm.Eq)
+	s.vmWriter.WriteArithmetic(vm.Not)
+	s.vmWriter.WritePush(vm.Temp, 1)
+	s.vmWriter.WriteArithmetic(vm.And)
+	s.vmWriter.WriteArithmetic(vm.Or)
+	s.vmWriter.WritePop(vm.Temp, 3)
+
+	s.writeDoubleToTop(2)
+	s.writeDouble(1)
+	s.vmWriter.WritePush(vm.Temp, 1)
+	s.vmWriter.WriteIf(lblBit)
+
+	s.vmWriter.WritePush(vm.Temp, 3)
+}
+
+// writeRepeat writes a loop running the code written by body as many
+// times as the value of temp i, counting it down. A count of 0 or less
+// runs no iterations.
+func (s *Service) writeRepeat(name string, i uint, body func()) {
+	lblLoop := s.vmWriter.RegisterLabel(name + "_LOOP")
+	lblEnd := s.vmWriter.RegisterLabel(name + "_END")
+
+	s.vmWriter.WriteLabel(lblLoop)
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WritePush(vm.Const, 0)
+	s.vmWriter.WriteArithmetic(vm.Gt)
+	s.vmWriter.WriteArithmetic(vm.Not)
+	s.vmWriter.WriteIf(lblEnd)
+
+	body()
+
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WritePush(vm.Const, 1)
+	s.vmWriter.WriteArithmetic(vm.Sub)
+	s.vmWriter.WritePop(vm.Temp, i)
+	s.vmWriter.WriteGoto(lblLoop)
+	s.vmWriter.WriteLabel(lblEnd)
+}
+
+// writeDouble doubles the value of temp i.
+func (s *Service) writeDouble(i uint) {
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WriteArithmetic(vm.Add)
+	s.vmWriter.WritePop(vm.Temp, i)
+}
+
+// writeDoubleToTop doubles the single bit set in temp i unless it is
+// already the top bit, -32768.
+func (s *Service) writeDoubleToTop(i uint) {
+	// i + (i & (i != -32768))
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.vmWriter.WritePush(vm.Temp, i)
+	s.pushInteger(-32768)
+	s.vmWriter.WriteArithmetic(vm.Eq)
+	s.vmWriter.WriteArithmetic(vm.Not)
+	s.vmWriter.WriteArithmetic(vm.And)
+	s.vmWriter.WriteArithmetic(vm.Add)
+	s.vmWriter.WritePop(vm.Temp, i)
+}
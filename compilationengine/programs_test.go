@@ -0,0 +1,159 @@
+package compilationengine_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm/interpreter"
+)
+
+const maxSteps = 50000000
+
+// load compiles the reference program and loads it into a new machine.
+func load(t *testing.T, program string) *interpreter.Machine {
+	t.Helper()
+
+	m := interpreter.New()
+	m.SetMaxSteps(maxSteps)
+
+	for _, fn := range jackFiles(t, program) {
+		name := strings.TrimSuffix(filepath.Base(fn), ".jack")
+
+		err := m.Load(name, bytes.NewReader(compileFile(t, fn)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m
+}
+
+func run(t *testing.T, m *interpreter.Machine) {
+	t.Helper()
+
+	err := m.Run()
+	if err != nil {
+		t.Fatalf("run failed after %d steps: %s\noutput:\n%s", m.Steps(), err, m.Output())
+	}
+}
+
+func keyScript(t *testing.T, script string) *interpreter.Script {
+	t.Helper()
+
+	s, err := interpreter.ParseScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func checkScreen(t *testing.T, m *interpreter.Machine, program string) {
+	t.Helper()
+
+	var screen bytes.Buffer
+
+	err := m.WriteScreenPBM(&screen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, filepath.Join("testdata", program, "screen.pbm"), screen.Bytes())
+}
+
+func TestSeven(t *testing.T) {
+	m := load(t, "Seven")
+	run(t, m)
+
+	if out := m.Output(); out != "7" {
+		t.Errorf("want output 7, got %q", out)
+	}
+}
+
+func TestConvertToBin(t *testing.T) {
+	for _, value := range []int16{0, 1, 5, 1234, 32767, -1, -32768} {
+		m := load(t, "ConvertToBin")
+		m.Poke(8000, value)
+		run(t, m)
+
+		for i := 0; i < 16; i++ {
+			want := int16((uint16(value) >> uint(i)) & 1)
+
+			if got := m.Peek(8001 + i); got != want {
+				t.Errorf("value %d: want RAM[%d] = %d, got %d", value, 8001+i, want, got)
+			}
+		}
+	}
+}
+
+func TestAverage(t *testing.T) {
+	m := load(t, "Average")
+	m.SetInput(strings.NewReader("3\n10\n20\n33\n"))
+	run(t, m)
+
+	want := "How many numbers? 3\n" +
+		"Enter a number: 10\n" +
+		"Enter a number: 20\n" +
+		"Enter a number: 33\n" +
+		"The average is 21"
+
+	if out := m.Output(); out != want {
+		t.Errorf("want output\n%s\ngot\n%s", want, out)
+	}
+}
+
+func TestComplexArrays(t *testing.T) {
+	m := load(t, "ComplexArrays")
+	run(t, m)
+
+	lines := strings.Split(strings.TrimSpace(m.Output()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("want 5 test results, got\n%s", m.Output())
+	}
+
+	for _, line := range lines {
+		var n, want, got int
+
+		_, err := fmt.Sscanf(line, "Test %d: expected result: %d; actual result: %d", &n, &want, &got)
+		if err != nil || want != got {
+			t.Errorf("unexpected result %q", line)
+		}
+	}
+}
+
+func TestSquare(t *testing.T) {
+	m := load(t, "Square")
+	m.SetKeyboardScript(keyScript(t, `
+frame 2 press RIGHT
+frame 3 release
+frame 40 press DOWN
+frame 41 release
+frame 70 press X
+frame 71 release
+frame 72 press X
+frame 73 release
+frame 90 press Q
+frame 91 release
+`))
+	run(t, m)
+
+	checkScreen(t, m, "Square")
+}
+
+func TestPong(t *testing.T) {
+	m := load(t, "Pong")
+	m.SetKeyboardScript(keyScript(t, `
+frame 3 press LEFT
+frame 6 release
+`))
+	run(t, m)
+
+	if out := m.Output(); out != "Score: 0Game Over" {
+		t.Errorf("want the game to end with score 0, got output %q", out)
+	}
+
+	checkScreen(t, m, "Pong")
+}
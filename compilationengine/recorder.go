@@ -0,0 +1,54 @@
+package compilationengine
+
+import (
+	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+// Recorder is told about the names declared and used in the class being
+// compiled along with the tokens naming them, which carry their positions.
+type Recorder interface {
+	// DeclareClass is called with the name of the compiled class.
+	DeclareClass(name tokenizer.Terminal)
+	// DeclareSubroutine is called with the name of a constructor, function
+	// or method before its parameters are declared.
+	DeclareSubroutine(name tokenizer.Terminal, kind, returnType string)
+	// EndSubroutine is called with the brace closing a subroutine body.
+	EndSubroutine(end tokenizer.Terminal)
+	// DeclareVariable is called for fields, statics, parameters and locals.
+	DeclareVariable(name tokenizer.Terminal, e *symbols.Entry)
+	// UseVariable is called for each use of a variable.
+	UseVariable(name tokenizer.Terminal, e *symbols.Entry)
+	// UseClass is called when a class name is used as a type or to call a
+	// function or a constructor of the class.
+	UseClass(name tokenizer.Terminal)
+	// UseSubroutine is called for each call of a subroutine of class.
+	UseSubroutine(name tokenizer.Terminal, class string)
+	// UseConstant is called for each use of a constant of another class.
+	UseConstant(name tokenizer.Terminal, class string)
+	// DeclareEnum is called with the name of an enum of the class before
+	// its members are declared.
+	DeclareEnum(name tokenizer.Terminal)
+	// UseEnum is called when an enum name is used as a type or to name a
+	// member of the enum.
+	UseEnum(name tokenizer.Terminal)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) DeclareClass(tokenizer.Terminal)                      {}
+func (nopRecorder) DeclareSubroutine(tokenizer.Terminal, string, string) {}
+func (nopRecorder) EndSubroutine(tokenizer.Terminal)                     {}
+func (nopRecorder) DeclareVariable(tokenizer.Terminal, *symbols.Entry)   {}
+func (nopRecorder) UseVariable(tokenizer.Terminal, *symbols.Entry)       {}
+func (nopRecorder) UseClass(tokenizer.Terminal)                          {}
+func (nopRecorder) UseSubroutine(tokenizer.Terminal, string)             {}
+func (nopRecorder) UseConstant(tokenizer.Terminal, string)               {}
+func (nopRecorder) DeclareEnum(tokenizer.Terminal)                       {}
+func (nopRecorder) UseEnum(tokenizer.Terminal)                           {}
+
+// SetRecorder sets the recorder told about the declarations and uses of
+// names during compilation.
+func (s *Service) SetRecorder(r Recorder) {
+	s.recorder = r
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/formatter"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+// formatCommand rewrites the given .jack files, or the .jack files of the
+// given directories, in the canonical style. With --check nothing is
+// written, the files needing formatting are listed and the command fails if
+// there are any.
+func formatCommand(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := fs.Bool("check", false, "list the files that are not formatted instead of rewriting them")
+	lang := fs.String("lang", "jack", "language: jack, or jack+ for the extensions")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatalf("please provide the files or folders to format")
+	}
+
+	l := language(*lang)
+	unformatted := 0
+
+	for _, path := range fs.Args() {
+		files, err := sourceFiles(path)
+		if err != nil {
+			log.Fatalf("unable to read %s: %s", path, err)
+		}
+
+		for _, fn := range files {
+			changed, err := formatFile(fn, l, !*check)
+			if err != nil {
+				log.Fatalf("formatting of file %s failed: %s", fn, err)
+			}
+
+			if changed && *check {
+				fmt.Println(fn)
+				unformatted += 1
+			}
+		}
+	}
+
+	if unformatted != 0 {
+		os.Exit(1)
+	}
+}
+
+// sourceFiles returns path if it is a file and the .jack files in it if it
+// is a directory.
+func sourceFiles(path string) ([]string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.IsDir() {
+		return []string{path}, nil
+	}
+
+	return filepath.Glob(filepath.Join(path, "*.jack"))
+}
+
+// formatFile formats fn, rewriting it if write is set, and reports whether
+// the formatted source differs from the file.
+func formatFile(fn string, l tokenizer.Lang, write bool) (bool, error) {
+	src, err := os.ReadFile(fn)
+	if err != nil {
+		return false, err
+	}
+
+	var out bytes.Buffer
+
+	err = formatter.Format(bytes.NewReader(src), &out, l)
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(src, out.Bytes()) {
+		return false, nil
+	}
+
+	if write {
+		return true, os.WriteFile(fn, out.Bytes(), 0644)
+	}
+
+	return true, nil
+}
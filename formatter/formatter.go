@@ -0,0 +1,796 @@
+// Package formatter pretty-prints Jack source code in a canonical style:
+// four spaces of indentation, one declaration or statement per line, opening
+// braces at the end of the line and single spaces around binary operators.
+// Comments are kept in place and blank lines of the source are kept, but
+// several blank lines in a row collapse into one.
+package formatter
+
+import (
+	"io"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+type formatter struct {
+	ts   []tokenizer.Terminal
+	i    int
+	p    printer
+	lang tokenizer.Lang
+}
+
+// Format reads a class written in the language l from in and writes it
+// formatted to out. A syntax error is a *compilationengine.Error.
+func Format(in io.ReadSeeker, out io.Writer, l tokenizer.Lang) error {
+	ts, err := tokens(in, l)
+	if err != nil {
+		return err
+	}
+
+	f := formatter{ts: ts, lang: l}
+
+	err = f.class()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, f.p.String())
+
+	return err
+}
+
+// tokens reads the tokens of the source up to and including EOF.
+func tokens(in io.ReadSeeker, l tokenizer.Lang) ([]tokenizer.Terminal, error) {
+	tk := tokenizer.New(in)
+	tk.SetLang(l)
+	ts := []tokenizer.Terminal{}
+
+	for {
+		tk.Advance()
+		t := tk.ConsumeToken()
+
+		if t.IsOfType(tokenizer.Error) {
+			return nil, compilationengine.ErrorAt(t, "")
+		}
+
+		ts = append(ts, t)
+
+		if t.IsOfType(tokenizer.EOF) {
+			return ts, nil
+		}
+	}
+}
+
+func (f *formatter) extensions() bool {
+	return f.lang == tokenizer.JackPlus
+}
+
+func (f *formatter) peek() tokenizer.Terminal {
+	return f.ts[f.i]
+}
+
+// emit writes the current token and moves to the next one.
+func (f *formatter) emit() {
+	t := f.ts[f.i]
+	f.p.token(t, text(t))
+
+	if !t.IsOfType(tokenizer.EOF) {
+		f.i += 1
+	}
+}
+
+func (f *formatter) keyword(ks ...string) error {
+	if t := f.peek(); !t.IsKeyword(ks...) {
+		return compilationengine.ErrorAt(t, "expected one of keywords %v but token was %s", ks, t)
+	}
+
+	f.emit()
+
+	return nil
+}
+
+func (f *formatter) symbol(ss ...string) error {
+	if t := f.peek(); !t.IsSymbol(ss...) {
+		return compilationengine.ErrorAt(t, "expected one of symbols %v but token was %s", ss, t)
+	}
+
+	f.emit()
+
+	return nil
+}
+
+func (f *formatter) identifier() error {
+	if t := f.peek(); !t.IsOfType(tokenizer.Identifier) {
+		return compilationengine.ErrorAt(t, "expected identifier but token was %s", t)
+	}
+
+	f.emit()
+
+	return nil
+}
+
+func (f *formatter) typ(void bool) error {
+	t := f.peek()
+
+	if t.IsOfType(tokenizer.Identifier) || t.IsKeyword("int", "char", "boolean") || void && t.IsKeyword("void") {
+		f.emit()
+		return nil
+	}
+
+	return compilationengine.ErrorAt(t, "expected a type but token was %s", t)
+}
+
+// closeBrace writes a closing brace, placing the comments before it at the
+// indentation of the block it closes.
+func (f *formatter) closeBrace() error {
+	t := f.peek()
+
+	if !t.IsSymbol("}") {
+		return compilationengine.ErrorAt(t, "expected one of symbols [}] but token was %s", t)
+	}
+
+	f.p.indent += 1
+	f.p.trivia(t)
+	f.p.indent -= 1
+	f.p.text(t, "}")
+	f.i += 1
+
+	return nil
+}
+
+func (f *formatter) class() error {
+	if err := f.keyword("class"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.symbol("{"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+	f.p.indent += 1
+
+	for f.peek().IsKeyword("static", "field", "const", "enum") {
+		var err error
+
+		switch {
+		case f.peek().IsKeyword("const"):
+			err = f.constDec()
+		case f.peek().IsKeyword("enum"):
+			err = f.enumDec()
+		default:
+			err = f.varDec()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for f.peek().IsKeyword("constructor", "function", "method") {
+		f.p.blank()
+
+		if err := f.subroutineDec(); err != nil {
+			return err
+		}
+	}
+
+	f.p.indent -= 1
+
+	if err := f.closeBrace(); err != nil {
+		return err
+	}
+
+	f.p.newline()
+
+	if t := f.peek(); !t.IsOfType(tokenizer.EOF) {
+		return compilationengine.ErrorAt(t, "expected end of file but token was %s", t)
+	}
+
+	f.p.trivia(f.peek())
+
+	return nil
+}
+
+// varDec writes a class variable or a local variable declaration.
+func (f *formatter) varDec() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.typ(false); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	for f.peek().IsSymbol(",") {
+		f.emit()
+		f.p.space()
+
+		if err := f.identifier(); err != nil {
+			return err
+		}
+	}
+
+	if err := f.symbol(";"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+
+	return nil
+}
+
+// constDec writes a class constant declaration of Jack+.
+func (f *formatter) constDec() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.typ(false); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.symbol("="); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.term(); err != nil {
+		return err
+	}
+
+	if err := f.symbol(";"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+
+	return nil
+}
+
+// enumDec writes an enum declaration of Jack+ on a single line.
+func (f *formatter) enumDec() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.symbol("{"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	for f.peek().IsSymbol(",") {
+		f.emit()
+		f.p.space()
+
+		if err := f.identifier(); err != nil {
+			return err
+		}
+	}
+
+	f.p.space()
+
+	if err := f.symbol("}"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+
+	return nil
+}
+
+func (f *formatter) subroutineDec() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.typ(true); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	if err := f.symbol("("); err != nil {
+		return err
+	}
+
+	if !f.peek().IsSymbol(")") {
+		if err := f.parameter(); err != nil {
+			return err
+		}
+
+		for f.peek().IsSymbol(",") {
+			f.emit()
+			f.p.space()
+
+			if err := f.parameter(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.symbol(")"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.symbol("{"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+	f.p.indent += 1
+
+	for f.peek().IsKeyword("var") {
+		if err := f.varDec(); err != nil {
+			return err
+		}
+	}
+
+	if err := f.statements(); err != nil {
+		return err
+	}
+
+	f.p.indent -= 1
+
+	if err := f.closeBrace(); err != nil {
+		return err
+	}
+
+	f.p.newline()
+
+	return nil
+}
+
+func (f *formatter) parameter() error {
+	if err := f.typ(false); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	return f.identifier()
+}
+
+// block writes a brace-enclosed list of statements.
+func (f *formatter) block() error {
+	if err := f.symbol("{"); err != nil {
+		return err
+	}
+
+	f.p.newline()
+	f.p.indent += 1
+
+	if err := f.statements(); err != nil {
+		return err
+	}
+
+	f.p.indent -= 1
+
+	return f.closeBrace()
+}
+
+func (f *formatter) statements() error {
+	for {
+		var err error
+
+		switch t := f.peek(); {
+		case t.IsKeyword("let"):
+			err = f.letStatement()
+		case t.IsKeyword("if"):
+			err = f.ifStatement()
+		case t.IsKeyword("while"):
+			err = f.whileStatement()
+		case t.IsKeyword("for"):
+			err = f.forStatement()
+		case t.IsKeyword("do"):
+			err = f.doStatement()
+		case t.IsKeyword("return"):
+			err = f.returnStatement()
+		case t.IsKeyword("break", "continue"):
+			f.emit()
+			err = f.symbol(";")
+		default:
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		f.p.newline()
+	}
+}
+
+func (f *formatter) letStatement() error {
+	if err := f.assignment(); err != nil {
+		return err
+	}
+
+	return f.symbol(";")
+}
+
+// assignment writes a let statement up to the semicolon ending it.
+// assignOps are the assignment operators, the compound ones are of Jack+.
+var assignOps = []string{"=", "+=", "-=", "*=", "|="}
+
+func (f *formatter) assignment() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	for f.peek().IsSymbol("[") {
+		if err := f.subscript(); err != nil {
+			return err
+		}
+	}
+
+	if f.peek().IsSymbol("++") {
+		f.emit()
+		return nil
+	}
+
+	f.p.space()
+
+	if err := f.symbol(assignOps...); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	return f.expression()
+}
+
+func (f *formatter) ifStatement() error {
+	if err := f.condition(); err != nil {
+		return err
+	}
+
+	if err := f.block(); err != nil {
+		return err
+	}
+
+	if !f.peek().IsKeyword("else") {
+		return nil
+	}
+
+	f.p.space()
+	f.emit()
+	f.p.space()
+
+	if f.extensions() && f.peek().IsKeyword("if") {
+		return f.ifStatement()
+	}
+
+	return f.block()
+}
+
+func (f *formatter) whileStatement() error {
+	if err := f.condition(); err != nil {
+		return err
+	}
+
+	return f.block()
+}
+
+func (f *formatter) forStatement() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.symbol("("); err != nil {
+		return err
+	}
+
+	if f.peek().IsKeyword("let") {
+		if err := f.letStatement(); err != nil {
+			return err
+		}
+	} else if err := f.symbol(";"); err != nil {
+		return err
+	}
+
+	if !f.peek().IsSymbol(";") {
+		f.p.space()
+
+		if err := f.expression(); err != nil {
+			return err
+		}
+	}
+
+	if err := f.symbol(";"); err != nil {
+		return err
+	}
+
+	if f.peek().IsKeyword("let") {
+		f.p.space()
+
+		if err := f.assignment(); err != nil {
+			return err
+		}
+	}
+
+	if err := f.symbol(")"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	return f.block()
+}
+
+// condition writes the keyword of an if or a while statement and the
+// parenthesized condition following it.
+func (f *formatter) condition() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.symbol("("); err != nil {
+		return err
+	}
+
+	if err := f.expression(); err != nil {
+		return err
+	}
+
+	if err := f.symbol(")"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	return nil
+}
+
+func (f *formatter) doStatement() error {
+	f.emit()
+	f.p.space()
+
+	if err := f.identifier(); err != nil {
+		return err
+	}
+
+	if err := f.call(); err != nil {
+		return err
+	}
+
+	return f.symbol(";")
+}
+
+func (f *formatter) returnStatement() error {
+	f.emit()
+
+	if !f.peek().IsSymbol(";") {
+		f.p.space()
+
+		if err := f.expression(); err != nil {
+			return err
+		}
+	}
+
+	return f.symbol(";")
+}
+
+func (f *formatter) expression() error {
+	if err := f.term(); err != nil {
+		return err
+	}
+
+	for f.peek().IsSymbol(compilationengine.BinaryOps...) {
+		f.p.space()
+		f.emit()
+		f.p.space()
+
+		if err := f.term(); err != nil {
+			return err
+		}
+	}
+
+	if f.peek().IsSymbol("?") {
+		return f.conditional()
+	}
+
+	return nil
+}
+
+// conditional writes the branches of a conditional expression of Jack+.
+func (f *formatter) conditional() error {
+	f.p.space()
+	f.emit()
+	f.p.space()
+
+	if err := f.expression(); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	if err := f.symbol(":"); err != nil {
+		return err
+	}
+
+	f.p.space()
+
+	return f.expression()
+}
+
+func (f *formatter) term() error {
+	switch t := f.peek(); {
+	case t.IsAnyOf(tokenizer.IntegerConstant, tokenizer.StringConstant, tokenizer.CharConstant):
+		f.emit()
+	case t.IsKeyword("true", "false", "null", "this"):
+		f.emit()
+	case t.IsSymbol("-", "~"):
+		f.emit()
+		return f.term()
+	case t.IsSymbol("("):
+		f.emit()
+
+		if err := f.expression(); err != nil {
+			return err
+		}
+
+		return f.symbol(")")
+	case t.IsSymbol("["):
+		return f.arrayLiteral()
+	case t.IsOfType(tokenizer.Identifier):
+		f.emit()
+
+		switch {
+		case f.peek().IsSymbol("["):
+			for f.peek().IsSymbol("[") {
+				if err := f.subscript(); err != nil {
+					return err
+				}
+			}
+		case f.peek().IsSymbol("("):
+			return f.arguments()
+		case f.peek().IsSymbol("."):
+			f.emit()
+
+			if err := f.identifier(); err != nil {
+				return err
+			}
+
+			// a class constant of Jack+ has no arguments
+			if f.extensions() && !f.peek().IsSymbol("(") {
+				return nil
+			}
+
+			return f.arguments()
+		}
+	default:
+		return compilationengine.ErrorAt(t, "expected a term but token was %s", t)
+	}
+
+	return nil
+}
+
+// arrayLiteral writes an array literal of Jack+. An element starting a
+// line in the source starts a continuation line, which keeps tables in rows.
+func (f *formatter) arrayLiteral() error {
+	f.emit()
+
+	if err := f.expression(); err != nil {
+		return err
+	}
+
+	for f.peek().IsSymbol(",") {
+		comma := f.peek()
+		f.emit()
+
+		if f.peek().Pos.Line > comma.Pos.Line {
+			f.p.breakLine()
+		} else {
+			f.p.space()
+		}
+
+		if err := f.expression(); err != nil {
+			return err
+		}
+	}
+
+	return f.symbol("]")
+}
+
+func (f *formatter) subscript() error {
+	f.emit()
+
+	if err := f.expression(); err != nil {
+		return err
+	}
+
+	return f.symbol("]")
+}
+
+// call writes the rest of a subroutine call following the first identifier.
+func (f *formatter) call() error {
+	if f.peek().IsSymbol(".") {
+		f.emit()
+
+		if err := f.identifier(); err != nil {
+			return err
+		}
+	}
+
+	return f.arguments()
+}
+
+// arguments writes the argument list of a subroutine call.
+func (f *formatter) arguments() error {
+	if err := f.symbol("("); err != nil {
+		return err
+	}
+
+	if !f.peek().IsSymbol(")") {
+		if err := f.expression(); err != nil {
+			return err
+		}
+
+		for f.peek().IsSymbol(",") {
+			f.emit()
+			f.p.space()
+
+			if err := f.expression(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return f.symbol(")")
+}
+
+// text returns the source text of t.
+func text(t tokenizer.Terminal) string {
+	switch t.Type {
+	case tokenizer.Keyword:
+		return t.Keyword
+	case tokenizer.Symbol:
+		return t.Symbol
+	case tokenizer.IntegerConstant:
+		return t.IntegerConstant
+	case tokenizer.StringConstant, tokenizer.CharConstant:
+		return t.Raw
+	case tokenizer.Identifier:
+		return t.Identifier
+	default:
+		return ""
+	}
+}
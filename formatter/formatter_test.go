@@ -0,0 +1,155 @@
+package formatter_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/formatter"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func format(t *testing.T, src []byte) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	err := formatter.Format(bytes.NewReader(src), &out, tokenizer.JackPlus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+func compile(t *testing.T, src []byte) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	err := compilationengine.New(tokenizer.New(bytes.NewReader(src)), vm.New(&out)).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+// TestFormatGolden formats the classes of testdata, Plus.jack being written
+// in Jack+, and compares the results with the golden files.
+func TestFormatGolden(t *testing.T) {
+	for _, name := range []string{"Messy", "Plus"} {
+		src, err := os.ReadFile(filepath.Join("testdata", name+".jack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := format(t, src)
+		fn := filepath.Join("testdata", name+".golden")
+
+		if *update {
+			if err := os.WriteFile(fn, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			continue
+		}
+
+		want, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatalf("%s, run the tests with -update to create it", err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+// TestFormatPrograms formats the reference programs of the compiler tests and
+// checks that formatting is idempotent and leaves the compiled code as is.
+func TestFormatPrograms(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "compilationengine", "testdata", "*", "*.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range files {
+		src, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		formatted := format(t, src)
+
+		if again := format(t, formatted); !bytes.Equal(again, formatted) {
+			t.Errorf("formatting %s is not idempotent:\n%s\n%s", fn, formatted, again)
+		}
+
+		if !bytes.Equal(compile(t, formatted), compile(t, src)) {
+			t.Errorf("formatting %s changed the compiled code", fn)
+		}
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	src := "class A {\n  method void f() {\n    let x 1;\n  }\n}\n"
+
+	err := formatter.Format(strings.NewReader(src), &bytes.Buffer{}, tokenizer.Jack)
+
+	var fe *compilationengine.Error
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a *compilationengine.Error, got %v", err)
+	}
+
+	if fe.Pos.Line != 3 || fe.Pos.Col != 11 {
+		t.Errorf("error at %s, want 3:11", fe.Pos)
+	}
+}
+
+func TestFormatUnterminatedComment(t *testing.T) {
+	src := "class A {\n  function void f() {\n    return;\n  }\n/* }\n"
+
+	err := formatter.Format(strings.NewReader(src), &bytes.Buffer{}, tokenizer.Jack)
+
+	var fe *compilationengine.Error
+	if !errors.As(err, &fe) || fe.Msg != "unterminated comment" {
+		t.Fatalf("want an unterminated comment error, got %v", err)
+	}
+
+	if fe.Pos.Line != 5 || fe.Pos.Col != 1 {
+		t.Errorf("error at %s, want 5:1", fe.Pos)
+	}
+}
+
+func TestFormatRejects(t *testing.T) {
+	tests := []struct {
+		src  string
+		lang tokenizer.Lang
+		want string
+	}{
+		{"do Foo.BAR;", tokenizer.JackPlus, "4:19: expected one of symbols [(] but token was {Type:symbol Symbol:;}"},
+		{"do Foo.BAR;", tokenizer.Jack, "4:19: expected one of symbols [(] but token was {Type:symbol Symbol:;}"},
+		{"let x = Foo.BAR;", tokenizer.Jack, "4:24: expected one of symbols [(] but token was {Type:symbol Symbol:;}"},
+		{"if (x) {\n        } else if (x) {\n        }", tokenizer.Jack, "5:16: expected one of symbols [{] but token was {Type:keyword Keyword:if}"},
+	}
+
+	for _, tt := range tests {
+		src := "class A {\n    function void f() {\n        var int x;\n        " + tt.src + "\n        return;\n    }\n}\n"
+
+		err := formatter.Format(strings.NewReader(src), &bytes.Buffer{}, tt.lang)
+
+		var fe *compilationengine.Error
+		if !errors.As(err, &fe) || fe.Error() != tt.want {
+			t.Errorf("%s in %s: want error %s, got %v", tt.src, tt.lang, tt.want, err)
+		}
+	}
+}
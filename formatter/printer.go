@@ -0,0 +1,191 @@
+package formatter
+
+import (
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+const indentation = "    "
+
+// printer lays out the tokens handed to it into lines. The formatter decides
+// where lines break, the printer places the comments of the tokens and keeps
+// the blank lines of the source.
+type printer struct {
+	lines     []string
+	cur       string
+	open      bool // a line has been started in cur
+	curIndent int
+	indent    int
+	sp        bool // a space goes before the next token on the line
+	cont      bool // the line continues a statement broken by a comment
+	blankNext bool // a blank line goes before the next line
+	opened    bool // the last thing written was an opening brace
+	last      int  // the source line the last token or comment ended on
+	lastOut   int  // the line holding the last token, -1 for cur
+}
+
+// token writes the trivia of t followed by s.
+func (p *printer) token(t tokenizer.Terminal, s string) {
+	p.trivia(t)
+	p.text(t, s)
+}
+
+// text writes s, the text of token t, to the current line.
+func (p *printer) text(t tokenizer.Terminal, s string) {
+	if !p.open && p.last > 0 && t.Pos.Line-p.last > 1 && !t.IsSymbol("}") {
+		p.blankNext = true
+	}
+
+	p.write(s)
+	p.opened = s == "{"
+	p.lastOut = -1
+	p.last = t.Pos.Line
+}
+
+// trivia writes the comments preceding t. A comment starting on the line of
+// the previous token stays at the end of that line, other comments get lines
+// of their own.
+func (p *printer) trivia(t tokenizer.Terminal) {
+	trailing := false
+
+	for _, c := range t.Trivia {
+		lines := strings.Split(c.Text, "\n")
+
+		if c.Pos.Line == p.last && len(lines) == 1 {
+			trailing = true
+
+			if p.lastOut == -1 {
+				p.cur += " " + c.Text
+
+				if strings.HasPrefix(c.Text, "//") {
+					p.breakLine()
+				}
+			} else {
+				p.lines[p.lastOut] += " " + c.Text
+			}
+
+			continue
+		}
+
+		if p.open {
+			p.breakLine()
+		}
+
+		// A comment right below a trailing comment continues it, so the
+		// blank line requested before the next declaration goes after it.
+		blank := p.blankNext
+		continued := trailing && c.Pos.Line == p.last+1
+		trailing = false
+
+		if continued {
+			p.blankNext = false
+		} else if p.last > 0 && c.Pos.Line-p.last > 1 {
+			p.blankNext = true
+		}
+
+		for i, l := range lines {
+			if i > 0 {
+				l = trimIndent(l, c.Pos.Col-1)
+			}
+
+			p.write(strings.TrimRight(l, " \t\r"))
+			p.endLine()
+		}
+
+		if continued {
+			p.blankNext = blank
+		}
+
+		p.opened = false
+		p.last = c.Pos.Line + len(lines) - 1
+	}
+}
+
+// space puts a space before the next token if it goes on the same line.
+func (p *printer) space() {
+	p.sp = true
+}
+
+// blank puts a blank line before the next line unless it follows an
+// opening brace.
+func (p *printer) blank() {
+	p.blankNext = true
+}
+
+// newline ends the current statement or declaration.
+func (p *printer) newline() {
+	p.endLine()
+	p.cont = false
+}
+
+// breakLine ends the current line in the middle of a statement, indenting
+// the rest of the statement one level deeper.
+func (p *printer) breakLine() {
+	p.endLine()
+	p.cont = true
+}
+
+func (p *printer) write(s string) {
+	if !p.open {
+		p.startLine()
+	} else if p.sp {
+		p.cur += " "
+	}
+
+	p.sp = false
+	p.cur += s
+}
+
+func (p *printer) startLine() {
+	if p.blankNext && !p.opened && len(p.lines) > 0 && p.lines[len(p.lines)-1] != "" {
+		p.lines = append(p.lines, "")
+	}
+
+	p.blankNext = false
+	p.open = true
+	p.curIndent = p.indent
+
+	if p.cont {
+		p.curIndent += 1
+	}
+}
+
+func (p *printer) endLine() {
+	if !p.open {
+		return
+	}
+
+	line := p.cur
+
+	if line != "" {
+		line = strings.Repeat(indentation, p.curIndent) + line
+	}
+
+	p.lines = append(p.lines, line)
+
+	if p.lastOut == -1 {
+		p.lastOut = len(p.lines) - 1
+	}
+
+	p.cur = ""
+	p.open = false
+	p.sp = false
+}
+
+func (p *printer) String() string {
+	p.newline()
+
+	return strings.Join(p.lines, "\n") + "\n"
+}
+
+// trimIndent removes up to n leading spaces and tabs of s.
+func trimIndent(s string, n int) string {
+	i := 0
+
+	for i < n && i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i += 1
+	}
+
+	return s[i:]
+}
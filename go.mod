@@ -1,3 +1,3 @@
 module github.com/pqkallio/nand2tetris-jack-compiler
 
-go 1.16
+go 1.18
@@ -0,0 +1,532 @@
+// Package index records the declarations and the uses of names in the
+// classes of a Jack program. Variables are resolved while compiling each
+// file, subroutines and classes are resolved across the files of the index.
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+type Kind int
+
+const (
+	Class Kind = iota
+	Subroutine
+	Variable
+	Enum
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Class:
+		return "class"
+	case Subroutine:
+		return "subroutine"
+	case Variable:
+		return "variable"
+	case Enum:
+		return "enum"
+	default:
+		return "unknown"
+	}
+}
+
+// Symbol is a declared class, subroutine, variable or enum.
+type Symbol struct {
+	Name string
+	Kind Kind
+	// Type is the type of a variable or the return type of a subroutine.
+	Type string
+	// Scope and Idx are the memory segment and the index of a variable.
+	Scope symbols.Scope
+	Idx   uint
+	// SubroutineKind is constructor, function or method.
+	SubroutineKind string
+	// Class is the class declaring the symbol, or the enum declaring a
+	// member.
+	Class string
+	// Parent is the subroutine declaring a parameter or a local variable.
+	Parent *Symbol
+	// Params are the parameters of a subroutine.
+	Params []*Symbol
+	File   string
+	Pos    tokenizer.Position
+	// End is the position of the brace closing a subroutine body. It is
+	// zero if the subroutine could not be compiled to the end.
+	End tokenizer.Position
+}
+
+func (s *Symbol) String() string {
+	switch s.Kind {
+	case Class:
+		return "class " + s.Name
+	case Enum:
+		return "enum " + s.Name
+	case Subroutine:
+		params := make([]string, len(s.Params))
+
+		for i, p := range s.Params {
+			params[i] = p.Type + " " + p.Name
+		}
+
+		return fmt.Sprintf("%s %s %s(%s)", s.SubroutineKind, s.Type, s.Name, strings.Join(params, ", "))
+	default:
+		return fmt.Sprintf("%s %s %s", declarator(s.Scope), s.Type, s.Name)
+	}
+}
+
+func declarator(s symbols.Scope) string {
+	switch s {
+	case symbols.Field:
+		return "field"
+	case symbols.Static:
+		return "static"
+	case symbols.Argument:
+		return "argument"
+	case symbols.Constant:
+		return "const"
+	default:
+		return "var"
+	}
+}
+
+// ID returns the name of the symbol qualified by the class and, for
+// parameters and locals, by the subroutine declaring it. Classes and enums
+// are named by their names only.
+func (s *Symbol) ID() string {
+	switch {
+	case s.Kind == Class || s.Kind == Enum:
+		return s.Name
+	case s.Parent != nil:
+		return s.Class + "." + s.Parent.Name + "." + s.Name
+	default:
+		return s.Class + "." + s.Name
+	}
+}
+
+// Use is a use of a name.
+type Use struct {
+	Name string
+	Kind Kind
+	File string
+	Pos  tokenizer.Position
+	// Class is the class of a called subroutine or of a constant of
+	// another class.
+	Class  string
+	symbol *Symbol
+}
+
+// File holds the symbols declared and the names used in a source file.
+type File struct {
+	Path    string
+	Class   *Symbol
+	Symbols []*Symbol
+	Uses    []*Use
+	// Err is the error compiling the file, the symbols and the uses up to
+	// the error are recorded.
+	Err error
+}
+
+// Index holds the files of a program.
+type Index struct {
+	files map[string]*File
+	lang  tokenizer.Lang
+	// constants are the constants declared by each file.
+	constants map[string]*compilationengine.Constants
+}
+
+func New() *Index {
+	return &Index{map[string]*File{}, tokenizer.Jack, map[string]*compilationengine.Constants{}}
+}
+
+// SetLang sets the language of the files added, plain Jack by default.
+func (x *Index) SetLang(l tokenizer.Lang) {
+	x.lang = l
+}
+
+// Load adds the .jack files of the directory dir to the index.
+func (x *Index) Load(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil {
+		return err
+	}
+
+	return x.AddFiles(files)
+}
+
+// AddFiles adds the files read from paths to the index. The constants of
+// every file are known before compiling any of them, so the files can use
+// each other's constants whatever their order.
+func (x *Index) AddFiles(paths []string) error {
+	srcs := make([][]byte, len(paths))
+
+	for i, fn := range paths {
+		src, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+
+		srcs[i] = src
+		x.scanConstants(fn, src)
+	}
+
+	for i, fn := range paths {
+		x.Add(fn, srcs[i])
+	}
+
+	return nil
+}
+
+// scanConstants records the constants declared by the source src of the
+// file path.
+func (x *Index) scanConstants(path string, src []byte) {
+	t := tokenizer.New(bytes.NewReader(src))
+	t.SetLang(x.lang)
+
+	x.constants[path], _ = compilationengine.ScanConstants(t)
+}
+
+// allConstants returns the constants declared by the files of the index.
+// The constants of the file path are merged last, so an enum clashing with
+// another enum or a class is reported for the file.
+func (x *Index) allConstants(path string) (*compilationengine.Constants, error) {
+	all := compilationengine.NewConstants()
+	paths := []string{}
+
+	for fn := range x.constants {
+		if fn != path {
+			paths = append(paths, fn)
+		}
+	}
+
+	sort.Strings(paths)
+
+	// clashes between the other files are reported for them
+	for _, fn := range paths {
+		all.Merge(x.constants[fn])
+	}
+
+	err := all.Merge(x.constants[path])
+
+	return all, err
+}
+
+// Add compiles the source src of the file path and records its symbols,
+// replacing any earlier version of the file.
+func (x *Index) Add(path string, src []byte) *File {
+	f := &File{Path: path}
+	r := &recorder{f: f, vars: map[*symbols.Entry]*Symbol{}}
+
+	x.scanConstants(path, src)
+	consts, err := x.allConstants(path)
+
+	t := tokenizer.New(bytes.NewReader(src))
+	t.SetLang(x.lang)
+
+	c := compilationengine.New(t, vm.New(io.Discard))
+	c.SetRecorder(r)
+	c.SetConstants(consts)
+	f.Err = c.Compile()
+
+	if err != nil {
+		f.Err = err
+	}
+
+	x.files[path] = f
+
+	return f
+}
+
+func (x *Index) Remove(path string) {
+	delete(x.constants, path)
+	delete(x.files, path)
+}
+
+func (x *Index) File(path string) *File {
+	return x.files[path]
+}
+
+// Files returns the files of the index ordered by path.
+func (x *Index) Files() []*File {
+	files := make([]*File, 0, len(x.files))
+
+	for _, f := range x.files {
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
+// Class returns the declaration of the class name.
+func (x *Index) Class(name string) *Symbol {
+	for _, f := range x.Files() {
+		if f.Class != nil && f.Class.Name == name {
+			return f.Class
+		}
+	}
+
+	return nil
+}
+
+// Enum returns the declaration of the enum name.
+func (x *Index) Enum(name string) *Symbol {
+	for _, f := range x.Files() {
+		for _, s := range f.Symbols {
+			if s.Kind == Enum && s.Name == name {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// Subroutines returns the subroutines of the class name.
+func (x *Index) Subroutines(class string) []*Symbol {
+	c := x.Class(class)
+	if c == nil {
+		return nil
+	}
+
+	subs := []*Symbol{}
+
+	for _, s := range x.files[c.File].Symbols {
+		if s.Kind == Subroutine {
+			subs = append(subs, s)
+		}
+	}
+
+	return subs
+}
+
+// Resolve returns the declaration of the name used by u, or nil if it is
+// not declared in the files of the index.
+func (x *Index) Resolve(u *Use) *Symbol {
+	switch {
+	case u.Kind == Variable && u.Class != "":
+		return x.constant(u.Class, u.Name)
+	case u.Kind == Variable:
+		return u.symbol
+	case u.Kind == Class:
+		return x.Class(u.Name)
+	case u.Kind == Enum:
+		return x.Enum(u.Name)
+	default:
+		for _, s := range x.Subroutines(u.Class) {
+			if s.Name == u.Name {
+				return s
+			}
+		}
+
+		return nil
+	}
+}
+
+// constant returns the declaration of the constant name of class, or of
+// the member name of an enum named class.
+func (x *Index) constant(class, name string) *Symbol {
+	for _, f := range x.Files() {
+		for _, s := range f.Symbols {
+			if s.Kind == Variable && s.Scope == symbols.Constant && s.Class == class && s.Name == name {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// References returns the uses of sym in the files of the index.
+func (x *Index) References(sym *Symbol) []*Use {
+	uses := []*Use{}
+
+	for _, f := range x.Files() {
+		for _, u := range f.Uses {
+			if x.Resolve(u) == sym {
+				uses = append(uses, u)
+			}
+		}
+	}
+
+	return uses
+}
+
+// At returns the symbol declared or used at the position line:col of the
+// file path, or nil if there is none.
+func (x *Index) At(path string, line, col int) *Symbol {
+	f := x.files[path]
+	if f == nil {
+		return nil
+	}
+
+	for _, s := range f.Symbols {
+		if covers(s.Pos, s.Name, line, col) {
+			return s
+		}
+	}
+
+	for _, u := range f.Uses {
+		if covers(u.Pos, u.Name, line, col) {
+			return x.Resolve(u)
+		}
+	}
+
+	return nil
+}
+
+// Visible returns the variables visible at the position line:col of the
+// file path: the fields and statics of the class and the parameters and
+// locals of the subroutine around the position.
+func (x *Index) Visible(path string, line, col int) []*Symbol {
+	f := x.files[path]
+	if f == nil {
+		return nil
+	}
+
+	vars := []*Symbol{}
+
+	for _, s := range f.Symbols {
+		if s.Kind != Variable {
+			continue
+		}
+
+		if s.Parent == nil || s.Parent.encloses(line, col) {
+			vars = append(vars, s)
+		}
+	}
+
+	return vars
+}
+
+// encloses reports whether the position line:col is within the subroutine.
+func (s *Symbol) encloses(line, col int) bool {
+	if !before(s.Pos, line, col) {
+		return false
+	}
+
+	return s.End.Line == 0 || !before(s.End, line, col)
+}
+
+// covers reports whether the name at pos covers the position line:col.
+func covers(pos tokenizer.Position, name string, line, col int) bool {
+	return pos.Line == line && col >= pos.Col && col < pos.Col+len(name)
+}
+
+// before reports whether pos is before the position line:col.
+func before(pos tokenizer.Position, line, col int) bool {
+	return pos.Line < line || pos.Line == line && pos.Col < col
+}
+
+// recorder records the declarations and uses of a file.
+type recorder struct {
+	f    *File
+	sub  *Symbol
+	vars map[*symbols.Entry]*Symbol
+}
+
+func (r *recorder) declare(s *Symbol) {
+	s.File = r.f.Path
+	r.f.Symbols = append(r.f.Symbols, s)
+}
+
+func (r *recorder) use(u *Use) {
+	u.File = r.f.Path
+	r.f.Uses = append(r.f.Uses, u)
+}
+
+func (r *recorder) className() string {
+	if r.f.Class == nil {
+		return ""
+	}
+
+	return r.f.Class.Name
+}
+
+func (r *recorder) DeclareClass(name tokenizer.Terminal) {
+	r.f.Class = &Symbol{Name: name.Identifier, Kind: Class, Class: name.Identifier, Pos: name.Pos}
+	r.declare(r.f.Class)
+}
+
+func (r *recorder) DeclareSubroutine(name tokenizer.Terminal, kind, returnType string) {
+	r.sub = &Symbol{
+		Name:           name.Identifier,
+		Kind:           Subroutine,
+		Type:           returnType,
+		SubroutineKind: kind,
+		Class:          r.className(),
+		Pos:            name.Pos,
+	}
+	r.declare(r.sub)
+}
+
+func (r *recorder) EndSubroutine(end tokenizer.Terminal) {
+	r.sub.End = end.Pos
+	r.sub = nil
+}
+
+func (r *recorder) DeclareVariable(name tokenizer.Terminal, e *symbols.Entry) {
+	s := &Symbol{
+		Name:  name.Identifier,
+		Kind:  Variable,
+		Type:  e.Type,
+		Scope: e.Scope,
+		Idx:   e.Idx,
+		Class: r.className(),
+		Pos:   name.Pos,
+	}
+
+	// the members of an enum belong to the enum
+	if enum, _, ok := strings.Cut(e.Name, "."); ok {
+		s.Class = enum
+	}
+
+	if e.Scope.In(symbols.Argument, symbols.Local) {
+		s.Parent = r.sub
+	}
+
+	if e.Scope == symbols.Argument {
+		r.sub.Params = append(r.sub.Params, s)
+	}
+
+	r.vars[e] = s
+	r.declare(s)
+}
+
+func (r *recorder) UseVariable(name tokenizer.Terminal, e *symbols.Entry) {
+	r.use(&Use{Name: name.Identifier, Kind: Variable, Pos: name.Pos, symbol: r.vars[e]})
+}
+
+func (r *recorder) UseClass(name tokenizer.Terminal) {
+	r.use(&Use{Name: name.Identifier, Kind: Class, Pos: name.Pos})
+}
+
+func (r *recorder) UseSubroutine(name tokenizer.Terminal, class string) {
+	r.use(&Use{Name: name.Identifier, Kind: Subroutine, Pos: name.Pos, Class: class})
+}
+
+func (r *recorder) UseConstant(name tokenizer.Terminal, class string) {
+	r.use(&Use{Name: name.Identifier, Kind: Variable, Pos: name.Pos, Class: class})
+}
+
+func (r *recorder) DeclareEnum(name tokenizer.Terminal) {
+	r.declare(&Symbol{Name: name.Identifier, Kind: Enum, Class: r.className(), Pos: name.Pos})
+}
+
+func (r *recorder) UseEnum(name tokenizer.Terminal) {
+	r.use(&Use{Name: name.Identifier, Kind: Enum, Pos: name.Pos})
+}
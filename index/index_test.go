@@ -0,0 +1,267 @@
+package index_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/index"
+	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+var square = filepath.Join("..", "compilationengine", "testdata", "Square")
+
+func load(t *testing.T) *index.Index {
+	t.Helper()
+
+	idx := index.New()
+
+	if err := idx.Load(square); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range idx.Files() {
+		if f.Err != nil {
+			t.Fatalf("%s: %s", f.Path, f.Err)
+		}
+	}
+
+	return idx
+}
+
+func TestAt(t *testing.T) {
+	idx := load(t)
+	game := filepath.Join(square, "SquareGame.jack")
+
+	// let square = Square.new(0, 0, 30);
+	tests := []struct {
+		line, col int
+		want      string
+		file      string
+	}{
+		{26, 11, "field Square square", "SquareGame.jack"},
+		{26, 20, "class Square", "Square.jack"},
+		{26, 27, "constructor Square new(int Ax, int Ay, int Asize)", "Square.jack"},
+		// do moveSquare();
+		{71, 16, "method void moveSquare()", "SquareGame.jack"},
+		// var char key;
+		{50, 16, "var char key", "SquareGame.jack"},
+	}
+
+	for _, tt := range tests {
+		sym := idx.At(game, tt.line, tt.col)
+		if sym == nil {
+			t.Errorf("%d:%d: no symbol", tt.line, tt.col)
+			continue
+		}
+
+		if sym.String() != tt.want || filepath.Base(sym.File) != tt.file {
+			t.Errorf("%d:%d: got %s in %s, want %s in %s", tt.line, tt.col, sym, sym.File, tt.want, tt.file)
+		}
+	}
+
+	// do Sys.wait(5); calls the OS, which is not part of the program
+	for _, col := range []int{10, 14, 1} {
+		if sym := idx.At(game, 44, col); sym != nil {
+			t.Errorf("44:%d: got %s", col, sym)
+		}
+	}
+}
+
+func TestVisible(t *testing.T) {
+	idx := load(t)
+	game := filepath.Join(square, "SquareGame.jack")
+
+	names := []string{}
+
+	for _, v := range idx.Visible(game, 60, 1) {
+		names = append(names, v.Name+":"+v.Scope.String())
+	}
+
+	want := "square:THIS direction:THIS key:LOCAL exit:LOCAL"
+
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for _, v := range idx.Visible(game, 35, 1) {
+		if v.Scope == symbols.Local {
+			t.Errorf("local %s visible outside its subroutine", v.Name)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	idx := load(t)
+
+	size := idx.At(filepath.Join(square, "Square.jack"), 10, 14)
+	if size == nil || size.ID() != "Square.size" {
+		t.Fatalf("got %v, want field size", size)
+	}
+
+	lines := []string{}
+
+	for _, u := range idx.References(size) {
+		lines = append(lines, u.Pos.String())
+	}
+
+	want := "16:11 30:41 30:51 37:41 37:51 43:17 43:38 45:14 45:21 53:11 55:14 55:21 65:42 65:57 65:67 68:44 75:16 77:44 80:42 80:57 80:67 89:39 89:57 89:67 92:51 99:16 101:51 104:39 104:57 104:67"
+
+	if got := strings.Join(lines, " "); got != want {
+		t.Errorf("got references %s", got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := load(t).Report()
+
+	external := []string{}
+
+	for _, e := range r.External {
+		external = append(external, e.ID)
+	}
+
+	want := "Keyboard Keyboard.keyPressed Memory Memory.deAlloc Screen Screen.drawRectangle Screen.setColor Sys Sys.wait"
+
+	if got := strings.Join(external, " "); got != want {
+		t.Errorf("got external %s, want %s", got, want)
+	}
+
+	for _, s := range r.Symbols {
+		if s.ID == "SquareGame.run.key" && (s.Scope != "LOCAL" || len(s.References) != 11) {
+			t.Errorf("got %+v for the local key", s)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	idx := index.New()
+	idx.SetLang(tokenizer.JackPlus)
+
+	idx.Add("Game.jack", []byte("class Game {\n    const int SPEED = 3;\n    enum Direction { UP, DOWN }\n}\n"))
+	f := idx.Add("Main.jack", []byte("class Main {\n    function int speed() {\n        return Game.SPEED + Direction.DOWN;\n    }\n}\n"))
+	if f.Err != nil {
+		t.Fatal(f.Err)
+	}
+
+	// return Game.SPEED;
+	sym := idx.At("Main.jack", 3, 21)
+	if sym == nil || sym.String() != "const int SPEED" || sym.File != "Game.jack" {
+		t.Fatalf("got %v, want const int SPEED in Game.jack", sym)
+	}
+
+	if refs := idx.References(sym); len(refs) != 1 || refs[0].File != "Main.jack" {
+		t.Errorf("got references %v, want one in Main.jack", refs)
+	}
+
+	// Direction.DOWN
+	down := idx.At("Main.jack", 3, 40)
+	if down == nil || down.String() != "const Direction DOWN" || down.ID() != "Direction.DOWN" {
+		t.Errorf("got %v, want const Direction DOWN", down)
+	}
+}
+
+func TestConstantsAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "A.jack")
+	z := filepath.Join(dir, "Z.jack")
+
+	// A uses the constant of Z, which is added after it
+	srcs := map[string]string{
+		a: "class A {\n    function int k() {\n        return Z.K;\n    }\n}\n",
+		z: "class Z {\n    const int K = 7;\n}\n",
+	}
+
+	for fn, src := range srcs {
+		if err := os.WriteFile(fn, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx := index.New()
+	idx.SetLang(tokenizer.JackPlus)
+
+	if err := idx.AddFiles([]string{a, z}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range idx.Files() {
+		if f.Err != nil {
+			t.Fatalf("%s: %s", f.Path, f.Err)
+		}
+	}
+
+	// return Z.K;
+	sym := idx.At(a, 3, 18)
+	if sym == nil || sym.ID() != "Z.K" || sym.File != z {
+		t.Fatalf("got %v, want Z.K in Z.jack", sym)
+	}
+
+	edits, err := idx.Rename(sym, "LIMIT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(edits) != 2 || edits[0].File != a || edits[1].File != z {
+		t.Errorf("got edits %v, want one in A.jack and one in Z.jack", edits)
+	}
+}
+
+func TestEnumUses(t *testing.T) {
+	idx := index.New()
+	idx.SetLang(tokenizer.JackPlus)
+
+	// the field uses the enum before it is declared
+	idx.Add("Game.jack", []byte("class Game {\n    field Direction d;\n    enum Direction { UP, DOWN }\n}\n"))
+	f := idx.Add("Main.jack", []byte("class Main {\n    function Direction down(Direction d) {\n        return Direction.DOWN;\n    }\n}\n"))
+	if f.Err != nil {
+		t.Fatal(f.Err)
+	}
+
+	// the return type
+	enum := idx.At("Main.jack", 2, 14)
+	if enum == nil || enum.String() != "enum Direction" || enum.Class != "Game" {
+		t.Fatalf("got %v, want enum Direction of Game", enum)
+	}
+
+	refs := []string{}
+	for _, u := range idx.References(enum) {
+		refs = append(refs, u.File+":"+u.Pos.String())
+	}
+
+	want := "Game.jack:2:11 Main.jack:2:14 Main.jack:2:29 Main.jack:3:16"
+	if got := strings.Join(refs, " "); got != want {
+		t.Errorf("got references %s, want %s", got, want)
+	}
+
+	if ext := idx.Report().External; len(ext) != 0 {
+		t.Errorf("got external %v, want none", ext)
+	}
+
+	edits, err := idx.Rename(enum, "Heading")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(edits) != 5 {
+		t.Errorf("got edits %v, want the declaration and 4 references", edits)
+	}
+
+	if _, err := idx.Rename(enum, "Main"); err == nil || !strings.Contains(err.Error(), "clashes with class Main") {
+		t.Errorf("got %v, want a clash with class Main", err)
+	}
+}
+
+func TestEnumClash(t *testing.T) {
+	idx := index.New()
+	idx.SetLang(tokenizer.JackPlus)
+
+	idx.Add("A.jack", []byte("class A {\n    enum E { X }\n}\n"))
+	f := idx.Add("B.jack", []byte("class B {\n    enum E { Y }\n}\n"))
+
+	if f.Err == nil || f.Err.Error() != "enum E declared in both A and B" {
+		t.Errorf("got error %v, want enum E declared in both A and B", f.Err)
+	}
+}
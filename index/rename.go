@@ -0,0 +1,182 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+// Edit replaces the name Old at Pos of File with New.
+type Edit struct {
+	File string
+	Pos  tokenizer.Position
+	Old  string
+	New  string
+}
+
+// Rename returns the edits renaming sym and every reference to it to name,
+// ordered by file and position. It fails if name is not an identifier or
+// is a keyword, or if the new name would clash with another declaration
+// or change what another name refers to.
+func (x *Index) Rename(sym *Symbol, name string) ([]Edit, error) {
+	if !isIdentifier(name) {
+		return nil, fmt.Errorf("%s is not an identifier", name)
+	}
+
+	if tokenizer.IsKeyword(name) {
+		return nil, fmt.Errorf("%s is a keyword", name)
+	}
+
+	if name == sym.Name {
+		return nil, fmt.Errorf("%s is already named %s", sym.ID(), name)
+	}
+
+	if err := x.checkClash(sym, name); err != nil {
+		return nil, err
+	}
+
+	edits := []Edit{{sym.File, sym.Pos, sym.Name, name}}
+
+	for _, u := range x.References(sym) {
+		edits = append(edits, Edit{u.File, u.Pos, u.Name, name})
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].File != edits[j].File {
+			return edits[i].File < edits[j].File
+		}
+
+		return edits[i].Pos.Offset < edits[j].Pos.Offset
+	})
+
+	return edits, nil
+}
+
+func (x *Index) checkClash(sym *Symbol, name string) error {
+	switch sym.Kind {
+	case Class, Enum:
+		// classes and enums share the names used as types
+		if c := x.Class(name); c != nil {
+			return clash(name, c)
+		}
+
+		if e := x.Enum(name); e != nil {
+			return clash(name, e)
+		}
+
+		for _, f := range x.Files() {
+			for _, u := range f.Uses {
+				if u.Kind == Class && u.Name == name {
+					return fmt.Errorf("%s is already used as a class at %s:%s", name, u.File, u.Pos)
+				}
+
+				if u.Kind == Enum && u.Name == name {
+					return fmt.Errorf("%s is already used as an enum at %s:%s", name, u.File, u.Pos)
+				}
+			}
+		}
+
+		// a variable of the new name would take over calls through the
+		// class
+		for _, u := range x.References(sym) {
+			if v := x.variable(u.File, u.Pos, name); v != nil {
+				return clash(name, v)
+			}
+		}
+	case Subroutine:
+		for _, s := range x.Subroutines(sym.Class) {
+			if s.Name == name {
+				return clash(name, s)
+			}
+		}
+	case Variable:
+		// another variable of the new name would be the same one or be
+		// shadowed where the variable is used
+		positions := []tokenizer.Position{sym.Pos}
+
+		for _, u := range x.References(sym) {
+			positions = append(positions, u.Pos)
+		}
+
+		for _, pos := range positions {
+			if v := x.variable(sym.File, pos, name); v != nil {
+				return clash(name, v)
+			}
+		}
+
+		// or the variable would shadow a class or a field used where it is
+		// visible
+		for _, u := range x.files[sym.File].Uses {
+			if u.Name != name || sym.Parent != nil && !sym.Parent.encloses(u.Pos.Line, u.Pos.Col) {
+				continue
+			}
+
+			shadowed := u.Kind == Class || u.Kind == Enum
+
+			if r := x.Resolve(u); u.Kind == Variable && r != nil && r.Parent == nil && sym.Parent != nil {
+				shadowed = true
+			}
+
+			if shadowed {
+				return fmt.Errorf("%s would shadow the %s used at %s:%s", name, u.Kind, u.File, u.Pos)
+			}
+		}
+	}
+
+	return nil
+}
+
+// variable returns the variable called name visible at pos of the file fn.
+func (x *Index) variable(fn string, pos tokenizer.Position, name string) *Symbol {
+	for _, v := range x.Visible(fn, pos.Line, pos.Col) {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func clash(name string, s *Symbol) error {
+	return fmt.Errorf("%s clashes with %s declared at %s:%s", name, s, s.File, s.Pos)
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+
+	for _, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply applies the edits of a file to its source src. The edits must be
+// ordered by position.
+func Apply(src []byte, edits []Edit) ([]byte, error) {
+	var out bytes.Buffer
+
+	at := 0
+
+	for _, e := range edits {
+		end := e.Pos.Offset + len(e.Old)
+
+		if e.Pos.Offset < at || end > len(src) || string(src[e.Pos.Offset:end]) != e.Old {
+			return nil, fmt.Errorf("%s:%s: %s not found", e.File, e.Pos, e.Old)
+		}
+
+		out.Write(src[at:e.Pos.Offset])
+		out.WriteString(e.New)
+		at = end
+	}
+
+	out.Write(src[at:])
+
+	return out.Bytes(), nil
+}
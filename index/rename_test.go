@@ -0,0 +1,93 @@
+package index_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/index"
+)
+
+func TestRename(t *testing.T) {
+	idx := load(t)
+	game := filepath.Join(square, "SquareGame.jack")
+
+	// the class Square, used in SquareGame and declared in Square
+	sym := idx.At(game, 26, 20)
+
+	edits, err := idx.Rename(sym, "Box")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]index.Edit{}
+
+	for _, e := range edits {
+		files[e.File] = append(files[e.File], e)
+	}
+
+	if len(files[game]) != 2 || len(files[filepath.Join(square, "Square.jack")]) != 2 {
+		t.Fatalf("got edits %v", edits)
+	}
+
+	src, err := os.ReadFile(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err = index.Apply(src, files[game])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"field Box square;", "let square = Box.new(0, 0, 30);"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("renamed source does not contain %q", want)
+		}
+	}
+
+	renamed := index.New()
+	renamed.Add(game, src)
+
+	if err := renamed.File(game).Err; err != nil {
+		t.Errorf("renamed source does not compile: %s", err)
+	}
+}
+
+func TestRenameRefused(t *testing.T) {
+	idx := load(t)
+	game := filepath.Join(square, "SquareGame.jack")
+
+	tests := []struct {
+		line, col int
+		name      string
+		err       string
+	}{
+		// var char key;
+		{50, 16, "while", "keyword"},
+		{50, 16, "9key", "not an identifier"},
+		{50, 16, "exit", "clashes with var boolean exit"},
+		{50, 16, "direction", "clashes with field int direction"},
+		{50, 16, "Keyboard", "would shadow the class"},
+		// field int direction;
+		{19, 14, "square", "clashes with field Square square"},
+		// method void moveSquare()
+		{39, 16, "run", "clashes with method void run()"},
+		// class SquareGame
+		{17, 7, "Square", "clashes with class Square"},
+		{17, 7, "Keyboard", "already used as a class"},
+	}
+
+	for _, tt := range tests {
+		sym := idx.At(game, tt.line, tt.col)
+		if sym == nil {
+			t.Fatalf("%d:%d: no symbol", tt.line, tt.col)
+		}
+
+		_, err := idx.Rename(sym, tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("renaming %s to %s: got error %v, want %q", sym.ID(), tt.name, err, tt.err)
+		}
+	}
+}
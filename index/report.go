@@ -0,0 +1,118 @@
+package index
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+)
+
+// Report is the cross-reference of the files of an index in a form meant
+// to be encoded as JSON. Lines and columns start from 1.
+type Report struct {
+	Symbols []ReportSymbol `json:"symbols"`
+	// External are the classes and subroutines used but not declared in
+	// the files of the index, such as those of the OS.
+	External []ReportSymbol `json:"external"`
+	Errors   []Location     `json:"errors,omitempty"`
+}
+
+type ReportSymbol struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`
+	Detail      string     `json:"detail,omitempty"`
+	Type        string     `json:"type,omitempty"`
+	Scope       string     `json:"scope,omitempty"`
+	Declaration *Location  `json:"declaration,omitempty"`
+	References  []Location `json:"references"`
+}
+
+type Location struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report returns the declarations of the files of the index with their
+// references.
+func (x *Index) Report() *Report {
+	r := &Report{Symbols: []ReportSymbol{}, External: []ReportSymbol{}}
+	refs := map[*Symbol][]Location{}
+	external := map[string]*ReportSymbol{}
+
+	for _, f := range x.Files() {
+		for _, u := range f.Uses {
+			loc := Location{File: u.File, Line: u.Pos.Line, Col: u.Pos.Col}
+
+			if sym := x.Resolve(u); sym != nil {
+				refs[sym] = append(refs[sym], loc)
+				continue
+			}
+
+			id := u.Name
+			if u.Kind == Subroutine {
+				id = u.Class + "." + u.Name
+			}
+
+			e, exists := external[id]
+			if !exists {
+				e = &ReportSymbol{ID: id, Name: u.Name, Kind: u.Kind.String(), References: []Location{}}
+				external[id] = e
+			}
+
+			e.References = append(e.References, loc)
+		}
+	}
+
+	for _, f := range x.Files() {
+		if f.Err != nil {
+			r.Errors = append(r.Errors, errorLocation(f))
+		}
+
+		for _, sym := range f.Symbols {
+			rs := ReportSymbol{
+				ID:          sym.ID(),
+				Name:        sym.Name,
+				Kind:        sym.Kind.String(),
+				Detail:      sym.String(),
+				Type:        sym.Type,
+				Declaration: &Location{File: sym.File, Line: sym.Pos.Line, Col: sym.Pos.Col},
+				References:  refs[sym],
+			}
+
+			if sym.Kind == Variable {
+				rs.Scope = sym.Scope.String()
+			}
+
+			if rs.References == nil {
+				rs.References = []Location{}
+			}
+
+			r.Symbols = append(r.Symbols, rs)
+		}
+	}
+
+	for _, e := range external {
+		r.External = append(r.External, *e)
+	}
+
+	sort.Slice(r.External, func(i, j int) bool {
+		return r.External[i].ID < r.External[j].ID
+	})
+
+	return r
+}
+
+// errorLocation returns the location and the message of the compilation
+// error of f.
+func errorLocation(f *File) Location {
+	var ce *compilationengine.Error
+
+	if errors.As(f.Err, &ce) {
+		return Location{File: f.Path, Line: ce.Pos.Line, Col: ce.Pos.Col, Message: ce.Msg}
+	}
+
+	return Location{File: f.Path, Message: f.Err.Error()}
+}
@@ -0,0 +1,472 @@
+// Package lsp implements a Language Server Protocol server for Jack. It
+// publishes the compilation errors of a file when it is opened or saved and
+// answers definition, references, hover, completion and document symbol
+// requests using an index of the directory of the file, a Jack program
+// being the classes of one directory.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/index"
+	"github.com/pqkallio/nand2tetris-jack-compiler/symbols"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+type Server struct {
+	in      *bufio.Reader
+	out     io.Writer
+	docs    map[string]string
+	indexes map[string]*index.Index
+	lang    tokenizer.Lang
+}
+
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{bufio.NewReader(in), out, map[string]string{}, map[string]*index.Index{}, tokenizer.Jack}
+}
+
+// SetLang sets the language of the programs, plain Jack by default.
+func (s *Server) SetLang(l tokenizer.Lang) {
+	s.lang = l
+}
+
+// Serve handles messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		body, err := readMessage(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		var req request
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req request) error {
+	var result interface{}
+	var err error
+
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    1,
+					"save":      true,
+				},
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "jackc"},
+		}
+	case "shutdown":
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			err = s.update(p.TextDocument.URI, p.TextDocument.Text, true)
+		}
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err = json.Unmarshal(req.Params, &p); err == nil && len(p.ContentChanges) != 0 {
+			err = s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text, false)
+		}
+	case "textDocument/didSave":
+		var p DidSaveTextDocumentParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			text, open := s.docs[path(p.TextDocument.URI)]
+
+			if p.Text != nil {
+				text, open = *p.Text, true
+			}
+
+			if open {
+				err = s.update(p.TextDocument.URI, text, true)
+			}
+		}
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			err = s.close(p.TextDocument.URI)
+		}
+	case "textDocument/definition":
+		var p TextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = s.definition(p)
+		}
+	case "textDocument/references":
+		var p ReferenceParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = s.references(p)
+		}
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = s.hover(p)
+		}
+	case "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = s.completion(p)
+		}
+	case "textDocument/documentSymbol":
+		var p DocumentSymbolParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = s.documentSymbols(p)
+		}
+	default:
+		if req.ID == nil {
+			return nil
+		}
+
+		return s.replyError(req.ID, codeMethodNotFound, fmt.Sprintf("method %s not supported", req.Method))
+	}
+
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		return s.replyError(req.ID, codeInvalidParams, err.Error())
+	}
+
+	return writeMessage(s.out, response{"2.0", req.ID, result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) error {
+	return writeMessage(s.out, errorResponse{"2.0", id, responseError{code, msg}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{"2.0", method, params})
+}
+
+// index returns the index of the program the file fn belongs to, loading
+// the files of its directory the first time.
+func (s *Server) index(fn string) *index.Index {
+	dir := filepath.Dir(fn)
+
+	idx, exists := s.indexes[dir]
+	if !exists {
+		idx = index.New()
+		idx.SetLang(s.lang)
+		idx.Load(dir)
+		s.indexes[dir] = idx
+	}
+
+	return idx
+}
+
+// update indexes the new text of the document at uri, publishing its
+// diagnostics if publish is set.
+func (s *Server) update(uri, text string, publish bool) error {
+	fn := path(uri)
+	s.docs[fn] = text
+
+	f := s.index(fn).Add(fn, []byte(text))
+
+	if !publish {
+		return nil
+	}
+
+	diagnostics := []Diagnostic{}
+
+	if f.Err != nil {
+		diagnostics = append(diagnostics, diagnostic(f.Err))
+	}
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{uri, diagnostics})
+}
+
+// close forgets the text of the document at uri, indexing the file as it
+// is on disk and clearing its diagnostics.
+func (s *Server) close(uri string) error {
+	fn := path(uri)
+	delete(s.docs, fn)
+
+	idx := s.index(fn)
+
+	if src, err := os.ReadFile(fn); err == nil {
+		idx.Add(fn, src)
+	} else {
+		idx.Remove(fn)
+	}
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{uri, []Diagnostic{}})
+}
+
+func diagnostic(err error) Diagnostic {
+	var ce *compilationengine.Error
+
+	d := Diagnostic{Severity: SeverityError, Source: "jackc", Message: err.Error()}
+
+	if errors.As(err, &ce) {
+		d.Message = ce.Msg
+		d.Range = Range{position(ce.Pos), position(ce.Pos)}
+		d.Range.End.Character += 1
+	}
+
+	return d
+}
+
+// symbolAt returns the symbol declared or used at p.
+func (s *Server) symbolAt(p TextDocumentPositionParams) *index.Symbol {
+	fn := path(p.TextDocument.URI)
+
+	return s.index(fn).At(fn, p.Position.Line+1, p.Position.Character+1)
+}
+
+func (s *Server) definition(p TextDocumentPositionParams) interface{} {
+	sym := s.symbolAt(p)
+	if sym == nil {
+		return nil
+	}
+
+	return Location{uri(sym.File), nameRange(sym)}
+}
+
+func (s *Server) references(p ReferenceParams) []Location {
+	locs := []Location{}
+
+	sym := s.symbolAt(p.TextDocumentPositionParams)
+	if sym == nil {
+		return locs
+	}
+
+	if p.Context.IncludeDeclaration {
+		locs = append(locs, Location{uri(sym.File), nameRange(sym)})
+	}
+
+	for _, u := range s.index(sym.File).References(sym) {
+		start := position(u.Pos)
+		end := start
+		end.Character += len(u.Name)
+
+		locs = append(locs, Location{uri(u.File), Range{start, end}})
+	}
+
+	return locs
+}
+
+func (s *Server) hover(p TextDocumentPositionParams) interface{} {
+	sym := s.symbolAt(p)
+	if sym == nil {
+		return nil
+	}
+
+	text := "```jack\n" + sym.String() + "\n```"
+
+	if sym.Kind == index.Variable {
+		text += fmt.Sprintf("\n\nscope `%s`, index %d", sym.Scope, sym.Idx)
+	}
+
+	return Hover{Contents: MarkupContent{"markdown", text}}
+}
+
+func (s *Server) completion(p TextDocumentPositionParams) []CompletionItem {
+	fn := path(p.TextDocument.URI)
+	idx := s.index(fn)
+	line, col := p.Position.Line+1, p.Position.Character+1
+	items := []CompletionItem{}
+
+	receiver, qualified := receiverAt(s.docs[fn], p.Position)
+
+	if qualified {
+		class := receiver
+
+		for _, v := range idx.Visible(fn, line, col) {
+			if v.Name == receiver {
+				class = v.Type
+			}
+		}
+
+		for _, sub := range idx.Subroutines(class) {
+			items = append(items, CompletionItem{sub.Name, completionKind(sub), sub.String()})
+		}
+
+		return items
+	}
+
+	for _, v := range idx.Visible(fn, line, col) {
+		kind := CompletionVariable
+		if v.Scope.In(symbols.Field, symbols.Static) {
+			kind = CompletionField
+		}
+
+		items = append(items, CompletionItem{v.Name, kind, v.String()})
+	}
+
+	if f := idx.File(fn); f != nil && f.Class != nil {
+		for _, sub := range idx.Subroutines(f.Class.Name) {
+			items = append(items, CompletionItem{sub.Name, completionKind(sub), sub.String()})
+		}
+	}
+
+	for _, f := range idx.Files() {
+		if f.Class != nil {
+			items = append(items, CompletionItem{f.Class.Name, CompletionClass, f.Class.String()})
+		}
+	}
+
+	return items
+}
+
+func completionKind(sub *index.Symbol) int {
+	switch sub.SubroutineKind {
+	case "constructor":
+		return CompletionConstructor
+	case "function":
+		return CompletionFunction
+	default:
+		return CompletionMethod
+	}
+}
+
+// receiverAt returns the name before the dot if the identifier being typed
+// at pos in text follows a dot.
+func receiverAt(text string, pos Position) (string, bool) {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return "", false
+	}
+
+	line := lines[pos.Line]
+	if pos.Character < len(line) {
+		line = line[:pos.Character]
+	}
+
+	line = strings.TrimRightFunc(line, isIdentifierChar)
+
+	if !strings.HasSuffix(line, ".") {
+		return "", false
+	}
+
+	line = strings.TrimSuffix(line, ".")
+	start := strings.LastIndexFunc(line, func(r rune) bool { return !isIdentifierChar(r) })
+
+	return line[start+1:], true
+}
+
+func isIdentifierChar(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func (s *Server) documentSymbols(p DocumentSymbolParams) []DocumentSymbol {
+	fn := path(p.TextDocument.URI)
+
+	f := s.index(fn).File(fn)
+	if f == nil || f.Class == nil {
+		return []DocumentSymbol{}
+	}
+
+	class := documentSymbol(f.Class, SymbolClass)
+	subs := map[*index.Symbol]int{}
+	enums := map[string]int{}
+
+	for _, sym := range f.Symbols {
+		switch {
+		case sym.Kind == index.Subroutine:
+			kind := SymbolMethod
+
+			switch sym.SubroutineKind {
+			case "constructor":
+				kind = SymbolConstructor
+			case "function":
+				kind = SymbolFunction
+			}
+
+			ds := documentSymbol(sym, kind)
+
+			if sym.End.Line != 0 {
+				ds.Range.End = position(sym.End)
+				ds.Range.End.Character += 1
+			}
+
+			subs[sym] = len(class.Children)
+			class.Children = append(class.Children, ds)
+		case sym.Kind == index.Enum:
+			enums[sym.Name] = len(class.Children)
+			class.Children = append(class.Children, documentSymbol(sym, SymbolEnum))
+		case sym.Kind == index.Variable && sym.Class != f.Class.Name:
+			// the members of an enum belong to the enum
+			i := enums[sym.Class]
+			class.Children[i].Children = append(class.Children[i].Children, documentSymbol(sym, SymbolEnumMember))
+		case sym.Kind == index.Variable && sym.Parent == nil:
+			class.Children = append(class.Children, documentSymbol(sym, SymbolField))
+		case sym.Kind == index.Variable:
+			i := subs[sym.Parent]
+			class.Children[i].Children = append(class.Children[i].Children, documentSymbol(sym, SymbolVariable))
+		}
+	}
+
+	return []DocumentSymbol{class}
+}
+
+func documentSymbol(sym *index.Symbol, kind int) DocumentSymbol {
+	r := nameRange(sym)
+
+	return DocumentSymbol{Name: sym.Name, Detail: sym.String(), Kind: kind, Range: r, SelectionRange: r}
+}
+
+// position converts a source position to a protocol position.
+func position(p tokenizer.Position) Position {
+	return Position{p.Line - 1, p.Col - 1}
+}
+
+// nameRange returns the range of the name of the declaration of sym.
+func nameRange(sym *index.Symbol) Range {
+	start := position(sym.Pos)
+	end := start
+	end.Character += len(sym.Name)
+
+	return Range{start, end}
+}
+
+// path returns the file path of a file URI.
+func path(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+// uri returns the file URI of a file path.
+func uri(fn string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(fn)}).String()
+}
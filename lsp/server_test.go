@@ -0,0 +1,294 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/lsp"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+const mainJack = `class Main {
+    function void main() {
+        var Counter c;
+        let c = Counter.new(3);
+        do c.
+        return;
+    }
+}
+`
+
+const counterJack = `class Counter {
+    field int count;
+
+    constructor Counter new(int start) {
+        let count = start;
+        return this;
+    }
+
+    method void inc() {
+        let count = count + 1;
+        return;
+    }
+}
+`
+
+type client struct {
+	t      *testing.T
+	in     io.Writer
+	out    *bufio.Reader
+	nextID int
+	notes  []map[string]interface{}
+}
+
+func (c *client) send(v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (c *client) read() map[string]interface{} {
+	length := 0
+
+	for {
+		line, err := c.out.ReadString('\n')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+
+		fmt.Sscanf(line, "Content-Length: %d", &length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		c.t.Fatal(err)
+	}
+
+	msg := map[string]interface{}{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return msg
+}
+
+// call sends a request and returns the result of the response to it,
+// keeping the notifications sent before the response.
+func (c *client) call(method string, params interface{}) interface{} {
+	c.t.Helper()
+
+	c.nextID += 1
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+
+	for {
+		msg := c.read()
+
+		if _, isNote := msg["method"]; isNote {
+			c.notes = append(c.notes, msg)
+			continue
+		}
+
+		if e, failed := msg["error"]; failed {
+			c.t.Fatalf("%s failed: %v", method, e)
+		}
+
+		return msg["result"]
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// diagnostics waits for the next diagnostics published.
+func (c *client) diagnostics() []interface{} {
+	c.t.Helper()
+
+	for len(c.notes) == 0 {
+		msg := c.read()
+		if _, isNote := msg["method"]; !isNote {
+			c.t.Fatalf("unexpected response %v", msg)
+		}
+
+		c.notes = append(c.notes, msg)
+	}
+
+	msg := c.notes[0]
+	c.notes = c.notes[1:]
+
+	if msg["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected notification %v", msg)
+	}
+
+	return msg["params"].(map[string]interface{})["diagnostics"].([]interface{})
+}
+
+func position(uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     map[string]int{"line": line, "character": char},
+	}
+}
+
+func fileURI(fn string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(fn)}).String()
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "Counter.jack"), []byte(counterJack), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mainURI := fileURI(filepath.Join(dir, "Main.jack"))
+	counterURI := fileURI(filepath.Join(dir, "Counter.jack"))
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error)
+
+	go func() {
+		done <- lsp.New(inR, outW).Serve()
+	}()
+
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR)}
+
+	c.call("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": mainURI, "languageId": "jack", "version": 1, "text": mainJack},
+	})
+
+	// the unfinished do statement is a compilation error
+	diags := c.diagnostics()
+	if len(diags) != 1 || !strings.Contains(fmt.Sprint(diags[0]), "line:5") {
+		t.Errorf("got diagnostics %v", diags)
+	}
+
+	// Counter.new
+	def := c.call("textDocument/definition", position(mainURI, 3, 25))
+	if loc, ok := def.(map[string]interface{}); !ok || loc["uri"] != counterURI || !strings.Contains(fmt.Sprint(loc["range"]), "line:3") {
+		t.Errorf("got definition %v", def)
+	}
+
+	refs := c.call("textDocument/references", map[string]interface{}{
+		"textDocument": map[string]string{"uri": counterURI},
+		"position":     map[string]int{"line": 1, "character": 15},
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+	if s := fmt.Sprint(refs); strings.Count(s, "uri:") != 4 {
+		t.Errorf("got references %v to count", refs)
+	}
+
+	hover := c.call("textDocument/hover", position(mainURI, 3, 12))
+	if s := fmt.Sprint(hover); !strings.Contains(s, "var Counter c") || !strings.Contains(s, "LOCAL") {
+		t.Errorf("got hover %v", hover)
+	}
+
+	completion := c.call("textDocument/completion", position(mainURI, 4, 13))
+	if s := fmt.Sprint(completion); !strings.Contains(s, "label:inc") || !strings.Contains(s, "label:new") {
+		t.Errorf("got completion %v", completion)
+	}
+
+	completion = c.call("textDocument/completion", position(counterURI, 9, 8))
+	if s := fmt.Sprint(completion); !strings.Contains(s, "label:count") || strings.Contains(s, "label:start") {
+		t.Errorf("got completion %v", completion)
+	}
+
+	symbols := c.call("textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": counterURI}})
+	if s := fmt.Sprint(symbols); !strings.Contains(s, "name:Counter") || !strings.Contains(s, "name:inc") || !strings.Contains(s, "name:start") {
+		t.Errorf("got document symbols %v", symbols)
+	}
+
+	fixed := strings.Replace(mainJack, "do c.", "do c.inc();", 1)
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": mainURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": fixed}},
+	})
+	c.notify("textDocument/didSave", map[string]interface{}{"textDocument": map[string]string{"uri": mainURI}})
+
+	if diags := c.diagnostics(); len(diags) != 0 {
+		t.Errorf("got diagnostics %v after the fix", diags)
+	}
+
+	c.call("shutdown", nil)
+	c.notify("exit", nil)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnumSymbols(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "Compass.jack")
+	src := "class Compass {\n    enum Direction { NORTH, SOUTH }\n    field Direction d;\n}\n"
+
+	if err := os.WriteFile(fn, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error)
+
+	server := lsp.New(inR, outW)
+	server.SetLang(tokenizer.JackPlus)
+
+	go func() {
+		done <- server.Serve()
+	}()
+
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR)}
+
+	c.call("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+
+	symbols := c.call("textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": fileURI(fn)}})
+
+	// the members are the children of the enum, the field follows it
+	classes := symbols.([]interface{})
+	children := classes[0].(map[string]interface{})["children"].([]interface{})
+
+	got := []string{}
+	for _, ch := range children {
+		sym := ch.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%v:%v", sym["name"], sym["kind"]))
+
+		members, _ := sym["children"].([]interface{})
+
+		for _, m := range members {
+			member := m.(map[string]interface{})
+			got = append(got, fmt.Sprintf("%v.%v:%v", sym["name"], member["name"], member["kind"]))
+		}
+	}
+
+	want := "Direction:10 Direction.NORTH:22 Direction.SOUTH:22 d:8"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("got document symbols %s, want %s", s, want)
+	}
+
+	c.call("shutdown", nil)
+	c.notify("exit", nil)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/lsp"
+)
+
+// lspCommand runs a language server speaking the Language Server Protocol
+// over stdin and stdout.
+func lspCommand(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	lang := fs.String("lang", "jack", "language: jack, or jack+ for the extensions")
+	fs.Parse(args)
+
+	s := lsp.New(os.Stdin, os.Stdout)
+	s.SetLang(language(*lang))
+
+	err := s.Serve()
+	if err != nil {
+		log.Fatalf("language server failed: %s", err)
+	}
+}
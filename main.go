@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/pqkallio/nand2tetris-jack-compiler/asm"
 	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
 	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
 	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
@@ -17,6 +21,11 @@ const (
 	dir
 )
 
+var emit = flag.String("emit", "vm", "output format: vm, asm or hack")
+var lang = flag.String("lang", "jack", "language: jack, or jack+ for the extensions")
+var precedence = flag.Bool("precedence", false, "apply binary operators by precedence instead of from left to right")
+var strict = flag.Bool("strict", false, "warn about values of other types assigned to enum variables")
+
 type fileInfo struct {
 	fullPath string
 	file     fs.FileInfo
@@ -58,12 +67,42 @@ func main() {
 
 	var data pathData
 
-	args := os.Args[1:]
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			runCommand(os.Args[2:])
+			return
+		case "fmt":
+			formatCommand(os.Args[2:])
+			return
+		case "lsp":
+			lspCommand(os.Args[2:])
+			return
+		case "xref":
+			xrefCommand(os.Args[2:])
+			return
+		case "rename":
+			renameCommand(os.Args[2:])
+			return
+		}
+	}
+
+	flag.Parse()
+
+	args := flag.Args()
 
 	if len(args) != 1 {
 		log.Fatalf("please provide only the file or folder to compile")
 	}
 
+	switch *emit {
+	case "vm", "asm", "hack":
+	default:
+		log.Fatalf("unknown output format %s", *emit)
+	}
+
+	l := language(*lang)
+
 	fn := args[0]
 
 	stat, err := os.Stat(fn)
@@ -82,12 +121,66 @@ func main() {
 		data.files = []fileInfo{{fn, stat}}
 	}
 
+	paths := make([]string, len(data.files))
+	for i, f := range data.files {
+		paths[i] = f.fullPath
+	}
+
+	consts, err := scanConstants(paths, l)
+	if err != nil {
+		log.Fatalf("compilation failed: %s", err)
+	}
+
 	for _, f := range data.files {
-		compileFile(&f)
+		compileFile(&f, l, consts)
+	}
+
+	if *emit != "vm" {
+		err = writeProgram(fn, data)
+		if err != nil {
+			log.Fatalf("unable to write %s output: %s", *emit, err)
+		}
 	}
 }
 
-func compileFile(f *fileInfo) {
+// language returns the language named by a --lang flag.
+func language(s string) tokenizer.Lang {
+	l, err := tokenizer.ParseLang(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return l
+}
+
+// scanConstants returns the constants declared by the classes of the files.
+// Errors in the files are left for their compilation to report, but an enum
+// clashing with another enum or a class is reported here.
+func scanConstants(paths []string, l tokenizer.Lang) (*compilationengine.Constants, error) {
+	consts := compilationengine.NewConstants()
+
+	for _, fn := range paths {
+		in, err := os.Open(fn)
+		if err != nil {
+			continue
+		}
+
+		t := tokenizer.New(in)
+		t.SetLang(l)
+
+		cs, _ := compilationengine.ScanConstants(t)
+		in.Close()
+
+		err = consts.Merge(cs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fn, err)
+		}
+	}
+
+	return consts, nil
+}
+
+func compileFile(f *fileInfo, l tokenizer.Lang, consts *compilationengine.Constants) {
 	log.Printf("compiling file %s", f.file.Name())
 	in, err := os.Open(f.fullPath)
 	if err != nil {
@@ -104,13 +197,125 @@ func compileFile(f *fileInfo) {
 		log.Fatalf("error opening file %s: %s", vmOutName, err)
 	}
 
+	defer vmOut.Close()
+
 	vmWriter := vm.New(vmOut)
 
 	t := tokenizer.New(in)
+	t.SetLang(l)
 	c := compilationengine.New(t, vmWriter)
+	c.SetPrecedence(*precedence)
+	c.SetStrict(*strict)
+	c.SetConstants(consts)
 
 	err = c.Compile()
 	if err != nil {
 		log.Fatalf("compilation of file %s failed: %s", f.fullPath, err.Error())
 	}
+
+	printWarnings(f.fullPath, c)
+}
+
+// printWarnings logs the warnings of the compilation of the file fn.
+func printWarnings(fn string, c *compilationengine.Service) {
+	for _, w := range c.Warnings() {
+		log.Printf("warning: %s:%s", fn, w)
+	}
+}
+
+// osFiles returns the .vm files of the Jack OS classes in the directory dir
+// that are not compiled from a Jack source there. Other .vm files, such as
+// those left from deleted sources, are not part of the program.
+func osFiles(dir string, compiled map[string]bool) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, fn := range matches {
+		name := strings.TrimSuffix(filepath.Base(fn), ".vm")
+		if asm.IsOSClass(name) && !compiled[name] {
+			files = append(files, fn)
+		}
+	}
+
+	return files, nil
+}
+
+// writeProgram translates the VM files of the compiled program into a single
+// Hack assembly file and, when emitting hack, assembles it into a ROM image.
+// When compiling a directory the .vm files of the Jack OS in it are included,
+// so the OS can be linked in by copying its .vm files next to the sources.
+func writeProgram(fn string, data pathData) error {
+	var vmFiles []string
+	var outName string
+
+	switch data.pathType {
+	case dir:
+		compiled := map[string]bool{}
+
+		for _, f := range data.files {
+			name := strings.TrimSuffix(f.fullPath, ".jack")
+			compiled[filepath.Base(name)] = true
+			vmFiles = append(vmFiles, name+".vm")
+		}
+
+		osVMFiles, err := osFiles(fn, compiled)
+		if err != nil {
+			return err
+		}
+
+		vmFiles = append(vmFiles, osVMFiles...)
+
+		// the program is named after the directory, even if given as "."
+		abs, err := filepath.Abs(fn)
+		if err != nil {
+			return err
+		}
+
+		outName = filepath.Join(fn, filepath.Base(abs))
+	default:
+		outName = strings.TrimSuffix(fn, ".jack")
+		vmFiles = []string{outName + ".vm"}
+	}
+
+	var program bytes.Buffer
+
+	tr := asm.NewTranslator(&program)
+	tr.WriteBootstrap()
+
+	for _, vmFile := range vmFiles {
+		in, err := os.Open(vmFile)
+		if err != nil {
+			return err
+		}
+
+		err = tr.Translate(strings.TrimSuffix(filepath.Base(vmFile), ".vm"), in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	tr.WriteRuntime()
+
+	if missing := tr.Unresolved(); len(missing) != 0 {
+		return fmt.Errorf("undefined functions %v, are the OS .vm files next to the sources?", missing)
+	}
+
+	out, err := os.Create(outName + "." + *emit)
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	if *emit == "asm" {
+		_, err = program.WriteTo(out)
+		return err
+	}
+
+	return asm.Assemble(&program, out)
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/index"
+)
+
+// renameCommand renames the class, subroutine or variable at a position and
+// every reference to it in the program, the .jack files of the directory of
+// the file. Renaming a class renames its file too.
+func renameCommand(args []string) {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	at := fs.String("at", "", "position of the name to rename as file:line:col")
+	lang := fs.String("lang", "jack", "language: jack, or jack+ for the extensions")
+	fs.Parse(args)
+
+	if *at == "" || fs.NArg() != 1 {
+		log.Fatalf("please provide the position of the name with --at and the new name")
+	}
+
+	name := fs.Arg(0)
+
+	fn, line, col, err := parseAt(*at)
+	if err != nil {
+		log.Fatalf("invalid position %s: %s", *at, err)
+	}
+
+	dir := filepath.Dir(fn)
+
+	idx, err := loadIndex(dir, language(*lang))
+	if err != nil {
+		log.Fatalf("unable to read %s: %s", dir, err)
+	}
+
+	for _, f := range idx.Files() {
+		if f.Err != nil {
+			log.Fatalf("compilation of file %s failed: %s", f.Path, f.Err)
+		}
+	}
+
+	sym := idx.At(fn, line, col)
+	if sym == nil {
+		log.Fatalf("no class, subroutine or variable declared in the program at %s", *at)
+	}
+
+	edits, err := idx.Rename(sym, name)
+	if err != nil {
+		log.Fatalf("unable to rename %s: %s", sym.ID(), err)
+	}
+
+	classFile := ""
+
+	if sym.Kind == index.Class && filepath.Base(sym.File) == sym.Name+".jack" {
+		classFile = filepath.Join(dir, name+".jack")
+
+		if _, err := os.Stat(classFile); err == nil {
+			log.Fatalf("unable to rename %s: %s exists", sym.ID(), classFile)
+		}
+	}
+
+	byFile := map[string][]index.Edit{}
+	files := []string{}
+
+	for _, e := range edits {
+		if _, exists := byFile[e.File]; !exists {
+			files = append(files, e.File)
+		}
+
+		byFile[e.File] = append(byFile[e.File], e)
+	}
+
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			log.Fatalf("unable to read %s: %s", f, err)
+		}
+
+		src, err = index.Apply(src, byFile[f])
+		if err != nil {
+			log.Fatalf("unable to rename in %s: %s", f, err)
+		}
+
+		err = os.WriteFile(f, src, 0644)
+		if err != nil {
+			log.Fatalf("unable to write %s: %s", f, err)
+		}
+
+		fmt.Println(f)
+	}
+
+	if classFile != "" {
+		err = os.Rename(sym.File, classFile)
+		if err != nil {
+			log.Fatalf("unable to rename %s: %s", sym.File, err)
+		}
+
+		fmt.Printf("%s -> %s\n", sym.File, classFile)
+	}
+}
+
+// parseAt splits a position given as file:line:col.
+func parseAt(at string) (string, int, int, error) {
+	parts := strings.Split(at, ":")
+	if len(parts) < 3 {
+		return "", 0, 0, fmt.Errorf("expected file:line:col")
+	}
+
+	n := len(parts)
+
+	line, err := strconv.Atoi(parts[n-2])
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	col, err := strconv.Atoi(parts[n-1])
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	return filepath.Clean(strings.Join(parts[:n-2], ":")), line, col, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/compilationengine"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm/interpreter"
+)
+
+// runCommand compiles the program in memory and executes it with the VM
+// interpreter. The program is a .jack file, a directory or the name of a
+// class, such as Main, in the working directory. Keyboard input is read from
+// stdin and the text the program prints is written to stdout.
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	maxSteps := fs.Uint64("max-steps", 0, "maximum number of VM commands to execute, 0 for no limit")
+	screen := fs.String("screen", "", "save the screen at exit to this .png or .pbm file")
+	onWait := fs.Bool("screen-on-wait", false, "also save the screen at every Sys.wait, numbering the files")
+	keys := fs.String("keys", "", "play the keyboard events of this script instead of reading stdin")
+	lang := fs.String("lang", "jack", "language: jack, or jack+ for the extensions")
+	prec := fs.Bool("precedence", false, "apply binary operators by precedence instead of from left to right")
+	strict := fs.Bool("strict", false, "warn about values of other types assigned to enum variables")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatalf("please provide only the class, file or folder to run")
+	}
+
+	path := programPath(fs.Arg(0))
+
+	m := interpreter.New()
+	m.SetInput(os.Stdin)
+	m.SetMaxSteps(*maxSteps)
+
+	if *keys != "" {
+		script, err := loadScript(*keys)
+		if err != nil {
+			log.Fatalf("unable to read keyboard script %s: %s", *keys, err)
+		}
+
+		m.SetKeyboardScript(script)
+	}
+
+	err := loadProgram(m, path, language(*lang), *prec, *strict)
+	if err != nil {
+		log.Fatalf("unable to load %s: %s", path, err)
+	}
+
+	if *screen != "" && *onWait {
+		n := 0
+
+		m.SetWaitHook(func(ms int16) error {
+			n += 1
+			ext := filepath.Ext(*screen)
+			return saveScreen(m, fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(*screen, ext), n, ext))
+		})
+	}
+
+	err = m.Run()
+
+	fmt.Print(m.Output())
+
+	if *screen != "" {
+		if err := saveScreen(m, *screen); err != nil {
+			log.Printf("unable to save the screen: %s", err)
+		}
+	}
+
+	if err != nil {
+		log.Fatalf("program failed after %d steps: %s", m.Steps(), err)
+	}
+}
+
+// programPath returns the path of the program named by arg. A class name
+// without a file of its own stands for the directory of its .jack file, so
+// the classes it uses are loaded too.
+func programPath(arg string) string {
+	if _, err := os.Stat(arg); err == nil || filepath.Ext(arg) != "" {
+		return arg
+	}
+
+	if _, err := os.Stat(arg + ".jack"); err != nil {
+		return arg
+	}
+
+	return filepath.Dir(arg + ".jack")
+}
+
+// loadProgram compiles the .jack files of path and loads them into the
+// machine along with the .vm files of the Jack OS in the directory that
+// have no Jack source, which replace the OS stand-ins.
+func loadProgram(m *interpreter.Machine, path string, l tokenizer.Lang, precedence, strict bool) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	jackFiles := []string{path}
+
+	if stat.IsDir() {
+		jackFiles, err = filepath.Glob(filepath.Join(path, "*.jack"))
+		if err != nil {
+			return err
+		}
+	}
+
+	compiled := map[string]bool{}
+	consts, err := scanConstants(jackFiles, l)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range jackFiles {
+		name := strings.TrimSuffix(filepath.Base(fn), ".jack")
+		compiled[name] = true
+
+		in, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+
+		var out bytes.Buffer
+
+		t := tokenizer.New(in)
+		t.SetLang(l)
+
+		c := compilationengine.New(t, vm.New(&out))
+		c.SetPrecedence(precedence)
+		c.SetStrict(strict)
+		c.SetConstants(consts)
+		err = c.Compile()
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("compilation of file %s failed: %s", fn, err)
+		}
+
+		printWarnings(fn, c)
+
+		err = m.Load(name, &out)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !stat.IsDir() {
+		return nil
+	}
+
+	vmFiles, err := osFiles(path, compiled)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range vmFiles {
+		name := strings.TrimSuffix(filepath.Base(fn), ".vm")
+
+		in, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+
+		err = m.Load(name, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadScript(fn string) (*interpreter.Script, error) {
+	in, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	defer in.Close()
+
+	return interpreter.ParseScript(in)
+}
+
+// saveScreen writes the screen of the machine to fn, in the PBM format if the
+// name ends with .pbm and as a PNG image otherwise.
+func saveScreen(m *interpreter.Machine, fn string) error {
+	out, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	if strings.EqualFold(filepath.Ext(fn), ".pbm") {
+		return m.WriteScreenPBM(out)
+	}
+
+	return m.WriteScreenPNG(out)
+}
@@ -9,6 +9,9 @@ const (
 	Static
 	Argument
 	Local
+	// Constant is the scope of the class constants of Jack+, which have a
+	// value instead of a place in memory.
+	Constant
 )
 
 func (s Scope) String() string {
@@ -21,6 +24,8 @@ func (s Scope) String() string {
 		return "ARG"
 	case Local:
 		return "LOCAL"
+	case Constant:
+		return "CONST"
 	default:
 		return "UNKNOWN"
 	}
@@ -44,6 +49,8 @@ func (s Scope) ToVMMemSeg() vm.MemSeg {
 		return vm.Static
 	case Argument:
 		return vm.Arg
+	case Constant:
+		return vm.Const
 	default:
 		return vm.Local
 	}
@@ -54,4 +61,6 @@ type Entry struct {
 	Scope Scope
 	Type  string
 	Idx   uint
+	// Value is the value of a constant.
+	Value int
 }
@@ -40,7 +40,7 @@ func (l *table) Define(name, dataType string, scope Scope) *Entry {
 
 	idx := l.nextIdxFor(scope)
 
-	e := Entry{name, scope, dataType, idx}
+	e := Entry{Name: name, Scope: scope, Type: dataType, Idx: idx}
 
 	l.symbols[name] = &e
 
@@ -63,3 +63,14 @@ func (t *table) GetSymbolCount(scope Scope) uint {
 
 	return 0
 }
+
+// entries returns the entries of the table.
+func (t *table) entries() []*Entry {
+	es := make([]*Entry, 0, len(t.symbols))
+
+	for _, e := range t.symbols {
+		es = append(es, e)
+	}
+
+	return es
+}
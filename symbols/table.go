@@ -5,7 +5,7 @@ type Table struct {
 	subroutineTable *table
 }
 
-var classScopes = []Scope{Static, Field}
+var classScopes = []Scope{Static, Field, Constant}
 var subroutineScopes = []Scope{Argument, Local}
 
 func New() *Table {
@@ -25,6 +25,8 @@ func (t *Table) Define(name, dataType, s string) *Entry {
 		scope = Static
 	case "arg":
 		scope = Argument
+	case "const":
+		scope = Constant
 	}
 
 	if scope.In(classScopes...) {
@@ -55,6 +57,19 @@ func (t *Table) SwitchSubroutineTo(subroutineName, funcType string) {
 	t.subroutineTable = newLocalTable(funcType, subroutineScopes...)
 }
 
+// Constants returns the constants of the class by name.
+func (t *Table) Constants() map[string]*Entry {
+	cs := map[string]*Entry{}
+
+	for _, e := range t.classTable.entries() {
+		if e.Scope == Constant {
+			cs[e.Name] = e
+		}
+	}
+
+	return cs
+}
+
 func (t *Table) GetSymbolCount(scope Scope) uint {
 	if scope.In(classScopes...) {
 		return t.classTable.GetSymbolCount(scope)
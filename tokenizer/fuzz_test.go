@@ -0,0 +1,88 @@
+package tokenizer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+var seeds = []string{
+	"class Main { function void main() { return; } }",
+	"let s = \"unterminated",
+	"let s = \"broken\nstring\";",
+	"x /",
+	"/* unterminated comment",
+	"// comment at EOF",
+	"identifierAtEOF",
+	"12345",
+	"a/b/*c*/d//e\nf",
+	"a&&b||c&&",
+	"'a' '\\n' '\\x4' '' 'ab' '\\'",
+	"\"\\\"\\q\\x41\\",
+	"0x4000 0b1010 1_000 0x 1__0 0xfffff 32768",
+	"let a[i] += 1; let i++; let j|=k-=2*=",
+	"a%b^c<<d>>e<<<f>>>g%",
+	"a<=b>=c!=d!e<==f!",
+	"a?b:c?d::?",
+}
+
+func FuzzTokenizer(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		checkTokens(t, in, tokenizer.Jack)
+		checkTokens(t, in, tokenizer.JackPlus)
+	})
+}
+
+// checkTokens tokenizes in as the language l and fails the test if the
+// tokenizer does not reach the end or gives invalid positions.
+func checkTokens(t *testing.T, in []byte, l tokenizer.Lang) {
+	tz := tokenizer.New(bytes.NewReader(in))
+	tz.SetLang(l)
+	prev := tokenizer.Position{Offset: -1}
+
+	// every token but EOF consumes at least a byte of the input
+	for i := 0; i <= len(in)+1; i++ {
+		tz.Advance()
+		tk := tz.ConsumeToken()
+
+		checkPosition(t, in, tk.Pos)
+
+		if tk.Pos.Offset <= prev.Offset && !tk.IsOfType(tokenizer.EOF) {
+			t.Fatalf("%s: token %s at %v does not follow the previous one at %v", l, tk, tk.Pos, prev)
+		}
+
+		if tk.IsOfType(tokenizer.Error) && tk.Err == "" {
+			t.Fatalf("%s: error token at %v has no message", l, tk.Pos)
+		}
+
+		if tk.IsOfType(tokenizer.EOF) {
+			return
+		}
+
+		prev = tk.Pos
+	}
+
+	t.Fatalf("%s: no EOF after %d tokens", l, len(in)+2)
+}
+
+// checkPosition fails the test if pos is not a position of in. The end of
+// the input is a valid position.
+func checkPosition(t *testing.T, in []byte, pos tokenizer.Position) {
+	t.Helper()
+
+	if pos.Offset < 0 || pos.Offset > len(in) {
+		t.Fatalf("offset %d outside of input of length %d", pos.Offset, len(in))
+	}
+
+	line := bytes.Count(in[:pos.Offset], []byte("\n")) + 1
+	col := pos.Offset - bytes.LastIndexByte(in[:pos.Offset], '\n')
+
+	if pos.Line != line || pos.Col != col {
+		t.Fatalf("offset %d is at %d:%d but the position is %v", pos.Offset, line, col, pos)
+	}
+}
@@ -0,0 +1,46 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseInteger returns the value of the Jack+ integer constant s, written
+// in decimal, in hexadecimal with 0x or in binary with 0b, with optional
+// underscores between the digits. Hexadecimal and binary constants are
+// 16-bit patterns, so 0xffff is -1. Decimal constants go up to 32768, which
+// is valid only negated.
+func ParseInteger(s string) (int, error) {
+	base := 10
+	digits := s
+
+	if len(s) > 1 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base, digits = 16, s[2:]
+		case 'b', 'B':
+			base, digits = 2, s[2:]
+		}
+	}
+
+	if digits == "" || strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return 0, fmt.Errorf("invalid integer constant %s", s)
+	}
+
+	v, err := strconv.ParseUint(strings.ReplaceAll(digits, "_", ""), base, 32)
+
+	switch {
+	case errors.Is(err, strconv.ErrRange):
+		return 0, fmt.Errorf("integer constant %s out of 16 bits", s)
+	case err != nil:
+		return 0, fmt.Errorf("invalid integer constant %s", s)
+	case base == 10 && v > 32768, v > 0xffff:
+		return 0, fmt.Errorf("integer constant %s out of 16 bits", s)
+	case base == 10:
+		return int(v), nil
+	default:
+		return int(int16(v)), nil
+	}
+}
@@ -0,0 +1,43 @@
+package tokenizer
+
+import "fmt"
+
+// Lang is the language the tokenizer reads: plain Jack or Jack with the
+// extensions of this compiler. The compilation engine asks the tokenizer
+// which one it reads to know the extensions enabled.
+type Lang int
+
+const (
+	Jack Lang = iota
+	JackPlus
+)
+
+func (l Lang) String() string {
+	switch l {
+	case JackPlus:
+		return "jack+"
+	default:
+		return "jack"
+	}
+}
+
+// ParseLang returns the language named s, jack or jack+.
+func ParseLang(s string) (Lang, error) {
+	switch s {
+	case "jack":
+		return Jack, nil
+	case "jack+":
+		return JackPlus, nil
+	default:
+		return Jack, fmt.Errorf("unknown language %s, expected jack or jack+", s)
+	}
+}
+
+// SetLang sets the language read, plain Jack by default.
+func (t *Service) SetLang(l Lang) {
+	t.lang = l
+}
+
+func (t *Service) Lang() Lang {
+	return t.lang
+}
@@ -1,7 +1,36 @@
 package tokenizer
 
 var symbols = "{}()[].,;+-*&|<>=~"
-var commentStarters = "*/"
+
+// extensionChars are the characters that are symbols only in Jack+. In
+// plain Jack they are part of identifiers.
+var extensionChars = "%^!?:"
+
+// extensionSymbols are the two character symbols of Jack+.
+var extensionSymbols = keywords{
+	"&&",
+	"||",
+	"+=",
+	"-=",
+	"*=",
+	"|=",
+	"++",
+	"<<",
+	">>",
+	"<=",
+	">=",
+	"!=",
+}
+
+// escapes are the characters of the Hack character set written with a
+// backslash in the string and character constants of Jack+, other than the
+// \xNN escapes of any character code.
+var escapes = map[byte]byte{
+	'n':  128,
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+}
 
 type keywords []string
 
@@ -38,3 +67,18 @@ var kws = keywords{
 	"null",
 	"this",
 }
+
+// extensionKws are the keywords added by the extensions of Jack+. In plain
+// Jack they are identifiers.
+var extensionKws = keywords{
+	"break",
+	"continue",
+	"for",
+	"const",
+	"enum",
+}
+
+// IsKeyword reports whether s is a keyword of Jack or of its extensions.
+func IsKeyword(s string) bool {
+	return kws.Contains(s) || extensionKws.Contains(s)
+}
@@ -13,6 +13,7 @@ const (
 	Symbol
 	IntegerConstant
 	StringConstant
+	CharConstant
 	Identifier
 	Comment
 	Error
@@ -29,6 +30,8 @@ func (t TokenType) String() string {
 		return "integerConstant"
 	case StringConstant:
 		return "stringConstant"
+	case CharConstant:
+		return "charConstant"
 	case Identifier:
 		return "identifier"
 	case Comment:
@@ -42,13 +45,41 @@ func (t TokenType) String() string {
 	}
 }
 
+// Position is the location of a token in the source. Offset counts bytes
+// from the start of the source, Line and Col start from 1.
+type Position struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Trivia is a comment in the source. Comments are kept as trivia of the
+// token following them, comments at the end of the source belong to the
+// EOF token.
+type Trivia struct {
+	Text string
+	Pos  Position
+}
+
 type Terminal struct {
 	Type            TokenType `xml:"-"`
 	Keyword         string    `xml:"keyword,omitempty"`
 	Symbol          string    `xml:"symbol,omitempty"`
 	IntegerConstant string    `xml:"integerConstant,omitempty"`
 	StringConstant  string    `xml:"stringConstant,omitempty"`
+	CharConstant    string    `xml:"-"`
 	Identifier      string    `xml:"identifier,omitempty"`
+	Err             string    `xml:"-"`
+	Pos             Position  `xml:"-"`
+	Trivia          []Trivia  `xml:"-"`
+
+	// Raw is the source text of a string or character constant, with the
+	// quotes and any escapes.
+	Raw string `xml:"-"`
 }
 
 func (t Terminal) IsOfType(tt TokenType) bool {
@@ -144,9 +175,17 @@ func (t Terminal) String() string {
 		s = fmt.Sprintf("%s String:%s", s, t.StringConstant)
 	}
 
+	if len(t.CharConstant) != 0 {
+		s = fmt.Sprintf("%s Char:%s", s, t.Raw)
+	}
+
 	if len(t.Identifier) != 0 {
 		s = fmt.Sprintf("%s Identifier:%s", s, t.Identifier)
 	}
 
+	if len(t.Err) != 0 {
+		s = fmt.Sprintf("%s Err:%s", s, t.Err)
+	}
+
 	return fmt.Sprintf("%s}", s)
 }
@@ -4,26 +4,32 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
 type Service struct {
-	f  *os.File
-	ts []Terminal
-	tp int
-	b  []byte
-	c  bool
+	f    io.ReadSeeker
+	ts   []Terminal
+	tp   int
+	b    []byte
+	c    bool
+	pos  Position
+	prev Position
+	lang Lang
 }
 
-func New(f *os.File) *Service {
+func New(f io.ReadSeeker) *Service {
 	return &Service{
 		f,
 		[]Terminal{},
 		-1,
 		make([]byte, 1),
 		false,
+		Position{0, 1, 1},
+		Position{0, 1, 1},
+		Jack,
 	}
 }
 
@@ -64,16 +70,21 @@ func (s *Service) Rewind(nSteps int) error {
 	return nil
 }
 
+// readNextToken reads the next token of the input. Comments preceding the
+// token are attached to it as trivia.
 func (t *Service) readNextToken() Terminal {
 	s := ""
+	trivia := []Trivia(nil)
 
 	for {
-		if _, err := t.f.Read(t.b); err != nil {
+		start := t.pos
+
+		if err := t.read(); err != nil {
 			if errors.Is(err, io.EOF) {
-				return Terminal{Type: EOF}
+				return Terminal{Type: EOF, Pos: t.pos, Trivia: trivia}
 			}
 
-			return Terminal{Type: Error}
+			return Terminal{Type: Error, Pos: start, Err: err.Error(), Trivia: trivia}
 		}
 
 		if unicode.IsSpace(rune(t.b[0])) {
@@ -82,79 +93,116 @@ func (t *Service) readNextToken() Terminal {
 
 		s = string(t.b[0])
 
-		if s == "/" {
-			t2 := t.parseSlash()
+		var tk Terminal
+
+		switch {
+		case s == "/":
+			c, ok, errTk := t.readComment()
+			if errTk != nil {
+				tk = *errTk
+				break
+			}
 
-			if t2.Type == Comment {
+			if ok {
+				trivia = append(trivia, Trivia{Text: c, Pos: start})
 				continue
 			}
 
-			return t2
+			tk = Terminal{Type: Symbol, Symbol: "/"}
+		case t.isSymbol(s):
+			tk = t.parseSymbol(s)
+		case t.b[0] > 0x2f && t.b[0] < 0x3a:
+			tk = t.parseInteger(s)
+		case s == "\"":
+			tk = t.parseString()
+		case s == "'" && t.lang == JackPlus:
+			tk = t.parseChar()
+		default:
+			tk = t.parseIdentifier(s)
 		}
 
-		if strings.Contains(symbols, s) {
-			return Terminal{Type: Symbol, Symbol: s}
+		// errors inside a token, such as a bad escape, have their own
+		// position
+		if tk.Pos == (Position{}) {
+			tk.Pos = start
 		}
 
-		if t.b[0] > 0x2f && t.b[0] < 0x3a {
-			return t.parseInteger(s)
-		}
+		tk.Trivia = trivia
 
-		if s == "\"" {
-			return t.parseString()
-		}
-
-		return t.parseIdentifier(s)
+		return tk
 	}
 }
 
-func (t *Service) parseSlash() Terminal {
-	baseCase := Terminal{Type: Symbol, Symbol: "/"}
-
-	if n, err := t.f.Read(t.b); err != nil || n == 0 {
-		return baseCase
+// read reads the next byte of the input to t.b, keeping track of the
+// position of the next byte.
+func (t *Service) read() error {
+	n, err := t.f.Read(t.b)
+	if err != nil {
+		return err
 	}
 
-	if unicode.IsSpace(rune(t.b[0])) {
-		return baseCase
+	if n == 0 {
+		return io.EOF
 	}
 
-	s := string(t.b[0])
+	t.prev = t.pos
+	t.pos.Offset += 1
 
-	if strings.Contains(commentStarters, s) {
-		t.skipComment(s)
-		return Terminal{Type: Comment}
+	if t.b[0] == '\n' {
+		t.pos.Line += 1
+		t.pos.Col = 1
+	} else {
+		t.pos.Col += 1
 	}
 
-	t.f.Seek(-1, 1)
-	return baseCase
+	return nil
+}
+
+// unread steps back the byte last read.
+func (t *Service) unread() {
+	t.f.Seek(-1, io.SeekCurrent)
+	t.pos = t.prev
 }
 
-func (t *Service) skipComment(start string) {
-	switch start {
+// readComment reads a comment following a slash. It reports false and
+// leaves the input untouched if the slash does not start a comment. A /*
+// comment without the closing */ gives an error token.
+func (t *Service) readComment() (string, bool, *Terminal) {
+	if err := t.read(); err != nil {
+		return "", false, nil
+	}
+
+	switch string(t.b[0]) {
 	case "*":
-		t.skipMultilineComment()
+		c, errTk := t.readMultilineComment()
+		return c, true, errTk
 	case "/":
-		t.skipSingleLineComment()
+		return t.readSingleLineComment(), true, nil
 	}
+
+	t.unread()
+	return "", false, nil
 }
 
-func (t *Service) skipMultilineComment() {
+// readMultilineComment reads the rest of a /* */ comment and returns the
+// whole comment.
+func (t *Service) readMultilineComment() (string, *Terminal) {
+	s := "/*"
 	starHit := false
 
 	for {
-		if n, err := t.f.Read(t.b); err != nil || n == 0 {
-			return
+		if err := t.read(); err != nil {
+			return "", &Terminal{Type: Error, Err: "unterminated comment"}
 		}
 
-		s := string(t.b[0])
+		s += string(t.b[0])
 
-		switch s {
-		case "*":
+		switch t.b[0] {
+		case '*':
 			starHit = true
-		case "/":
+		case '/':
 			if starHit {
-				return
+				return s, nil
 			}
 		default:
 			starHit = false
@@ -162,22 +210,49 @@ func (t *Service) skipMultilineComment() {
 	}
 }
 
-func (t *Service) skipSingleLineComment() {
+// readSingleLineComment reads the rest of a // comment and returns the
+// comment without the line break ending it.
+func (t *Service) readSingleLineComment() string {
+	s := "//"
+
 	for {
-		if n, err := t.f.Read(t.b); err != nil || n == 0 {
-			return
+		if err := t.read(); err != nil || t.b[0] == '\n' {
+			return strings.TrimRight(s, "\r")
 		}
 
-		if string(t.b[0]) == "\n" {
-			return
+		s += string(t.b[0])
+	}
+}
+
+// isSymbol reports whether the character s is a symbol of the language of t.
+func (t *Service) isSymbol(s string) bool {
+	return strings.Contains(symbols, s) || t.lang == JackPlus && strings.Contains(extensionChars, s)
+}
+
+// parseSymbol reads a symbol starting with s. In Jack+ a symbol may be two
+// characters long.
+func (t *Service) parseSymbol(s string) Terminal {
+	if t.lang == JackPlus {
+		if err := t.read(); err == nil {
+			if s2 := s + string(t.b[0]); extensionSymbols.Contains(s2) {
+				return Terminal{Type: Symbol, Symbol: s2}
+			}
+
+			t.unread()
 		}
 	}
+
+	return Terminal{Type: Symbol, Symbol: s}
 }
 
 func (t *Service) parseInteger(s string) Terminal {
+	if t.lang == JackPlus {
+		return t.parseExtendedInteger(s)
+	}
+
 	for {
-		if n, err := t.f.Read(t.b); err != nil || n == 0 {
-			return Terminal{Type: Error}
+		if err := t.read(); err != nil {
+			break
 		}
 
 		if unicode.IsSpace(rune(t.b[0])) {
@@ -185,7 +260,7 @@ func (t *Service) parseInteger(s string) Terminal {
 		}
 
 		if t.b[0] < 0x30 || t.b[0] > 0x39 {
-			t.f.Seek(-1, 1)
+			t.unread()
 			break
 		}
 
@@ -195,30 +270,156 @@ func (t *Service) parseInteger(s string) Terminal {
 	return Terminal{Type: IntegerConstant, IntegerConstant: s}
 }
 
+// parseExtendedInteger reads an integer constant of Jack+, which may be
+// hexadecimal or binary and have underscores between the digits. The
+// constant is kept as written.
+func (t *Service) parseExtendedInteger(s string) Terminal {
+	for {
+		if err := t.read(); err != nil {
+			break
+		}
+
+		c := t.b[0]
+
+		if !isWordChar(c) {
+			t.unread()
+			break
+		}
+
+		s = s + string(c)
+	}
+
+	if _, err := ParseInteger(s); err != nil {
+		return Terminal{Type: Error, Err: err.Error()}
+	}
+
+	return Terminal{Type: IntegerConstant, IntegerConstant: s}
+}
+
 func (t *Service) parseString() Terminal {
-	s := ""
+	v, raw, errTk := t.readQuoted('"', "string")
+	if errTk != nil {
+		return *errTk
+	}
+
+	return Terminal{Type: StringConstant, StringConstant: string(v), Raw: raw}
+}
+
+// parseChar reads a character constant of Jack+.
+func (t *Service) parseChar() Terminal {
+	v, raw, errTk := t.readQuoted('\'', "character")
+	if errTk != nil {
+		return *errTk
+	}
+
+	if len(v) != 1 {
+		return Terminal{Type: Error, Err: "character constant must be a single character"}
+	}
+
+	return Terminal{Type: CharConstant, CharConstant: string(v), Raw: raw}
+}
+
+// readQuoted reads the rest of a constant of the kind kind ending with the
+// quote. It returns the value and the source text of the constant, or an
+// error token. In Jack+ the escapes in the constant are decoded, an unknown
+// escape is reported at the backslash once the constant ends.
+func (t *Service) readQuoted(quote byte, kind string) ([]byte, string, *Terminal) {
+	v := []byte{}
+	raw := string(quote)
+
+	var escErr *Terminal
 
 	for {
-		if n, err := t.f.Read(t.b); err != nil || n == 0 {
-			return Terminal{Type: Error}
+		if err := t.read(); err != nil || t.b[0] == '\n' {
+			return nil, "", &Terminal{Type: Error, Err: fmt.Sprintf("unterminated %s constant", kind)}
 		}
 
-		s2 := string(t.b[0])
+		c := t.b[0]
+		raw += string(c)
 
-		if s2 == "\"" {
+		if c == quote {
 			break
 		}
 
-		s = s + s2
+		if c == '\\' && t.lang == JackPlus {
+			pos := t.prev
+
+			esc, text, ok := t.readEscape()
+			raw += text
+
+			if !ok && escErr == nil {
+				escErr = &Terminal{Type: Error, Err: fmt.Sprintf("unknown escape \\%s", text), Pos: pos}
+			}
+
+			c = esc
+		}
+
+		v = append(v, c)
+	}
+
+	if escErr != nil {
+		return nil, "", escErr
 	}
 
-	return Terminal{Type: StringConstant, StringConstant: s}
+	return v, raw, nil
+}
+
+// readEscape reads an escape following a backslash. It returns the
+// character of the Hack character set the escape stands for and the source
+// text of the escape after the backslash, and reports false if the escape
+// is unknown.
+func (t *Service) readEscape() (byte, string, bool) {
+	if err := t.read(); err != nil {
+		return 0, "", false
+	}
+
+	if t.b[0] == '\n' {
+		// leave the line break to end the unterminated constant
+		t.unread()
+		return 0, "", false
+	}
+
+	if c, ok := escapes[t.b[0]]; ok {
+		return c, string(t.b[0]), true
+	}
+
+	if t.b[0] != 'x' {
+		return 0, string(t.b[0]), false
+	}
+
+	text := "x"
+
+	for i := 0; i < 2; i++ {
+		if err := t.read(); err != nil {
+			return 0, text, false
+		}
+
+		if !isHexDigit(t.b[0]) {
+			t.unread()
+			return 0, text, false
+		}
+
+		text += string(t.b[0])
+	}
+
+	c, _ := strconv.ParseUint(text[1:], 16, 8)
+
+	return byte(c), text, true
+}
+
+// isWordChar reports whether c is an ASCII letter, digit or underscore.
+func isWordChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
 }
 
 func (t *Service) parseIdentifier(s string) Terminal {
 	for {
-		if n, err := t.f.Read(t.b); err != nil || n == 0 {
-			return Terminal{Type: Error}
+		if err := t.read(); err != nil {
+			break
 		}
 
 		if unicode.IsSpace(rune(t.b[0])) {
@@ -227,15 +428,15 @@ func (t *Service) parseIdentifier(s string) Terminal {
 
 		s2 := string(t.b[0])
 
-		if strings.Contains(symbols, s2) {
-			t.f.Seek(-1, 1)
+		if t.isSymbol(s2) {
+			t.unread()
 			break
 		}
 
 		s = s + s2
 	}
 
-	if kws.Contains(s) {
+	if kws.Contains(s) || t.lang == JackPlus && extensionKws.Contains(s) {
 		return Terminal{Type: Keyword, Keyword: s}
 	}
 
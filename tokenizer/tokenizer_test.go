@@ -0,0 +1,24 @@
+package tokenizer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+func TestUnterminatedComment(t *testing.T) {
+	tz := tokenizer.New(strings.NewReader("class A {\n/* never closed\n}\n"))
+
+	for i := 0; i < 3; i++ {
+		tz.Advance()
+		tz.ConsumeToken()
+	}
+
+	tz.Advance()
+	tk := tz.ConsumeToken()
+
+	if !tk.IsOfType(tokenizer.Error) || tk.Err != "unterminated comment" || tk.Pos.Line != 2 || tk.Pos.Col != 1 {
+		t.Errorf("want error 2:1: unterminated comment, got %s at %s", tk, tk.Pos)
+	}
+}
@@ -0,0 +1,81 @@
+package interpreter
+
+// builtin is a Go stand-in for a Jack OS function. The arguments are passed
+// in the order they were pushed, so methods receive this as args[0].
+type builtin func(m *Machine, args []int16) (int16, error)
+
+// native is a stand-in with the number of arguments of the OS function,
+// which the calls to it must pass.
+type native struct {
+	nArgs int
+	fn    builtin
+}
+
+var builtins = map[string]native{
+	"Array.new":     {1, arrayNew},
+	"Array.dispose": {1, arrayDispose},
+
+	"Keyboard.init":       {0, nop},
+	"Keyboard.keyPressed": {0, keyboardKeyPressed},
+	"Keyboard.readChar":   {0, keyboardReadChar},
+	"Keyboard.readLine":   {1, keyboardReadLine},
+	"Keyboard.readInt":    {1, keyboardReadInt},
+
+	"Math.init":     {0, nop},
+	"Math.abs":      {1, mathAbs},
+	"Math.multiply": {2, mathMultiply},
+	"Math.divide":   {2, mathDivide},
+	"Math.min":      {2, mathMin},
+	"Math.max":      {2, mathMax},
+	"Math.sqrt":     {1, mathSqrt},
+
+	"Memory.init":    {0, nop},
+	"Memory.peek":    {1, memoryPeek},
+	"Memory.poke":    {2, memoryPoke},
+	"Memory.alloc":   {1, memoryAlloc},
+	"Memory.deAlloc": {1, memoryDeAlloc},
+
+	"Output.init":        {0, nop},
+	"Output.moveCursor":  {2, outputMoveCursor},
+	"Output.printChar":   {1, outputPrintChar},
+	"Output.printString": {1, outputPrintString},
+	"Output.printInt":    {1, outputPrintInt},
+	"Output.println":     {0, outputPrintln},
+	"Output.backSpace":   {0, outputBackSpace},
+
+	"Screen.init":          {0, nop},
+	"Screen.clearScreen":   {0, screenClearScreen},
+	"Screen.setColor":      {1, screenSetColor},
+	"Screen.drawPixel":     {2, screenDrawPixel},
+	"Screen.drawLine":      {4, screenDrawLine},
+	"Screen.drawRectangle": {4, screenDrawRectangle},
+	"Screen.drawCircle":    {3, screenDrawCircle},
+
+	"String.new":           {1, stringNew},
+	"String.dispose":       {1, stringDispose},
+	"String.length":        {1, stringLength},
+	"String.charAt":        {2, stringCharAt},
+	"String.setCharAt":     {3, stringSetCharAt},
+	"String.appendChar":    {2, stringAppendChar},
+	"String.eraseLastChar": {1, stringEraseLastChar},
+	"String.intValue":      {1, stringIntValue},
+	"String.setInt":        {2, stringSetInt},
+	"String.backSpace":     {0, stringBackSpace},
+	"String.doubleQuote":   {0, stringDoubleQuote},
+	"String.newLine":       {0, stringNewLine},
+
+	"Sys.halt":  {0, sysHalt},
+	"Sys.error": {1, sysError},
+	"Sys.wait":  {1, sysWait},
+}
+
+// Jack character set codes of the special keys
+const (
+	newLine     = 128
+	backSpace   = 129
+	doubleQuote = 34
+)
+
+func nop(m *Machine, args []int16) (int16, error) {
+	return 0, nil
+}
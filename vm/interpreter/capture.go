@@ -0,0 +1,63 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// ScreenImage returns the contents of the screen memory map as a 512x256
+// image with black pixels for set bits.
+func (m *Machine) ScreenImage() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, screenWidth, screenHeight))
+
+	for y := 0; y < screenHeight; y++ {
+		for x := 0; x < screenWidth; x++ {
+			c := color.White
+			if m.pixel(x, y) {
+				c = color.Black
+			}
+
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// WriteScreenPNG writes the screen as a PNG image.
+func (m *Machine) WriteScreenPNG(w io.Writer) error {
+	return png.Encode(w, m.ScreenImage())
+}
+
+// WriteScreenPBM writes the screen as a plain PBM image, which is easy to
+// diff against a golden file.
+func (m *Machine) WriteScreenPBM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "P1\n%d %d\n", screenWidth, screenHeight)
+
+	for y := 0; y < screenHeight; y++ {
+		for x := 0; x < screenWidth; x++ {
+			b := byte('0')
+			if m.pixel(x, y) {
+				b = '1'
+			}
+
+			bw.WriteByte(b)
+
+			if x%64 == 63 {
+				bw.WriteByte('\n')
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+func (m *Machine) pixel(x, y int) bool {
+	return m.ram[ScreenBase+y*screenWords+x/16]&(1<<uint(x%16)) != 0
+}
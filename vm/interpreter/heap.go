@@ -0,0 +1,69 @@
+package interpreter
+
+import "fmt"
+
+type block struct {
+	base, size int
+}
+
+// heap is a first-fit allocator of the RAM between base and end. Unlike the
+// Jack OS it keeps its bookkeeping outside of the RAM, so programs that write
+// past the end of an object cannot corrupt it.
+type heap struct {
+	free  []block
+	sizes map[int]int
+}
+
+func newHeap(base, end int) *heap {
+	return &heap{[]block{{base, end - base}}, map[int]int{}}
+}
+
+func (h *heap) alloc(size int) (int, bool) {
+	for i, b := range h.free {
+		if b.size < size {
+			continue
+		}
+
+		if b.size == size {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+		} else {
+			h.free[i] = block{b.base + size, b.size - size}
+		}
+
+		h.sizes[b.base] = size
+
+		return b.base, true
+	}
+
+	return 0, false
+}
+
+func (h *heap) deAlloc(base int) error {
+	size, exists := h.sizes[base]
+	if !exists {
+		return fmt.Errorf("address %d is not an allocated block", base)
+	}
+
+	delete(h.sizes, base)
+
+	i := 0
+	for i < len(h.free) && h.free[i].base < base {
+		i++
+	}
+
+	h.free = append(h.free, block{})
+	copy(h.free[i+1:], h.free[i:])
+	h.free[i] = block{base, size}
+
+	if i+1 < len(h.free) && h.free[i].base+h.free[i].size == h.free[i+1].base {
+		h.free[i].size += h.free[i+1].size
+		h.free = append(h.free[:i+1], h.free[i+2:]...)
+	}
+
+	if i > 0 && h.free[i-1].base+h.free[i-1].size == h.free[i].base {
+		h.free[i-1].size += h.free[i].size
+		h.free = append(h.free[:i], h.free[i+1:]...)
+	}
+
+	return nil
+}
@@ -0,0 +1,569 @@
+// Package interpreter executes the VM code produced by the compiler. The Jack
+// OS classes are provided by Go stand-ins unless the loaded code defines the
+// class itself, so programs can be run and tested without the VM emulator.
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+const (
+	sp = iota
+	lcl
+	arg
+	this
+	that
+)
+
+const (
+	tempBase     = 5
+	staticBase   = 16
+	staticEnd    = 256
+	stackBase    = 256
+	heapBase     = 2048
+	heapEnd      = 16384
+	ScreenBase   = 16384
+	KeyboardAddr = 24576
+	ramSize      = 32768
+)
+
+// ErrStepLimit is returned by Run when the program executes more commands
+// than allowed by SetMaxSteps.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// SysError is returned by Run when the program calls Sys.error, or when an OS
+// stand-in detects an error the Jack OS reports with Sys.error.
+type SysError struct {
+	Code int16
+}
+
+func (e *SysError) Error() string {
+	return fmt.Sprintf("ERR%d", e.Code)
+}
+
+type frame struct {
+	funcName string
+	ret      int
+}
+
+type Machine struct {
+	ram        [ramSize]int16
+	code       []command
+	funcs      map[string]int
+	classes    map[string]bool
+	nextStatic int
+	calls      []frame
+	pc         int
+	steps      uint64
+	maxSteps   uint64
+	halted     bool
+	heap       *heap
+	output     *output
+	screen     *screen
+	keyboard   *keyboard
+	waitHook   func(ms int16) error
+}
+
+func New() *Machine {
+	return &Machine{
+		funcs:      map[string]int{},
+		classes:    map[string]bool{},
+		nextStatic: staticBase,
+		heap:       newHeap(heapBase, heapEnd),
+		output:     newOutput(),
+		screen:     newScreen(),
+		keyboard:   newKeyboard(),
+	}
+}
+
+// Load parses the VM commands of a single file. fileName is the name of the
+// file without the .vm suffix and it determines the static segment the
+// commands of the file share.
+func (m *Machine) Load(fileName string, in io.Reader) error {
+	cmds, err := parse(fileName, in)
+	if err != nil {
+		return err
+	}
+
+	nStatics := 0
+
+	for _, cmd := range cmds {
+		if cmd.seg == vm.Static && cmd.n >= nStatics {
+			nStatics = cmd.n + 1
+		}
+	}
+
+	if m.nextStatic+nStatics > staticEnd {
+		return fmt.Errorf("%s.vm: static segment overflow", fileName)
+	}
+
+	offset := len(m.code)
+
+	for i, cmd := range cmds {
+		switch cmd.op {
+		case opFunction:
+			if _, exists := m.funcs[cmd.name]; exists {
+				return fmt.Errorf("%s.vm:%d: function %s defined twice", fileName, cmd.lineNo, cmd.name)
+			}
+
+			m.funcs[cmd.name] = offset + i
+			m.classes[className(cmd.name)] = true
+		case opGoto, opIfGoto:
+			cmds[i].target += offset
+		}
+
+		if cmd.seg == vm.Static {
+			// static commands address the RAM directly
+			cmds[i].n += m.nextStatic
+		}
+	}
+
+	m.nextStatic += nStatics
+	m.code = append(m.code, cmds...)
+
+	return nil
+}
+
+// SetInput sets the reader the Keyboard stand-in reads characters from.
+func (m *Machine) SetInput(in io.Reader) {
+	m.keyboard.setInput(in)
+}
+
+// SetKeyboardScript makes the Keyboard stand-in play the events of the
+// script instead of reading the input set with SetInput.
+func (m *Machine) SetKeyboardScript(s *Script) {
+	m.keyboard.setScript(s)
+}
+
+// SetMaxSteps limits the number of VM commands Run executes, 0 means no
+// limit.
+func (m *Machine) SetMaxSteps(n uint64) {
+	m.maxSteps = n
+}
+
+// SetWaitHook sets a function that is called with the duration every time
+// the program calls Sys.wait. An error returned by the hook stops the
+// program.
+func (m *Machine) SetWaitHook(hook func(ms int16) error) {
+	m.waitHook = hook
+}
+
+// Peek returns the value of the RAM at addr.
+func (m *Machine) Peek(addr int) int16 {
+	return m.ram[addr]
+}
+
+// Poke sets the value of the RAM at addr.
+func (m *Machine) Poke(addr int, v int16) {
+	m.ram[addr] = v
+}
+
+// Output returns the text printed by the program with the Output class.
+func (m *Machine) Output() string {
+	return m.output.String()
+}
+
+// Steps returns the number of VM commands executed so far.
+func (m *Machine) Steps() uint64 {
+	return m.steps
+}
+
+// Run executes the program starting from Sys.init, or from Main.main when
+// the loaded code does not define Sys.init, until it halts or returns from
+// the entry function.
+func (m *Machine) Run() error {
+	err := m.link()
+	if err != nil {
+		return err
+	}
+
+	entry := "Sys.init"
+	if _, defined := m.funcs[entry]; !defined {
+		entry = "Main.main"
+	}
+
+	start, defined := m.funcs[entry]
+	if !defined {
+		return fmt.Errorf("function %s not defined", entry)
+	}
+
+	m.ram[sp] = stackBase
+	m.ram[lcl] = stackBase
+	m.ram[arg] = stackBase
+
+	err = m.call(entry, start, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	m.playKeyEvents()
+
+	for !m.halted {
+		if m.maxSteps != 0 && m.steps >= m.maxSteps {
+			return ErrStepLimit
+		}
+
+		// a function without a return runs on into the next function or
+		// past the end of the code
+		if m.pc >= len(m.code) || m.code[m.pc].op == opFunction && m.code[m.pc].name != m.currentFunc() {
+			return fmt.Errorf("%s: end of function reached without return", m.currentFunc())
+		}
+
+		cmd := m.code[m.pc]
+
+		m.steps += 1
+
+		err = m.exec(&cmd)
+		if err != nil {
+			var sysErr *SysError
+			if errors.As(err, &sysErr) {
+				return err
+			}
+
+			return fmt.Errorf("%s:%d: %w", m.currentFunc(), cmd.lineNo, err)
+		}
+	}
+
+	return nil
+}
+
+// link resolves the target of every call, either to a loaded function or to
+// an OS stand-in of a class the loaded code does not define. A call to a
+// stand-in must pass the number of arguments the OS function takes.
+func (m *Machine) link() error {
+	undefined := map[string]bool{}
+	funcName := ""
+
+	for i, cmd := range m.code {
+		if cmd.op == opFunction {
+			funcName = cmd.name
+		}
+
+		if cmd.op != opCall {
+			continue
+		}
+
+		if target, exists := m.funcs[cmd.name]; exists {
+			m.code[i].target = target
+			continue
+		}
+
+		if b, exists := builtins[cmd.name]; exists && !m.classes[className(cmd.name)] {
+			if cmd.n != b.nArgs {
+				return fmt.Errorf("%s:%d: %s called with %d arguments, takes %d", funcName, cmd.lineNo, cmd.name, cmd.n, b.nArgs)
+			}
+
+			m.code[i].target = -1
+			m.code[i].native = b.fn
+			continue
+		}
+
+		undefined[cmd.name] = true
+	}
+
+	if len(undefined) != 0 {
+		names := []string{}
+		for name := range undefined {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return fmt.Errorf("undefined functions %s", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// exec executes a single command and moves the program counter to the next
+// command to execute.
+func (m *Machine) exec(cmd *command) error {
+	switch cmd.op {
+	case opPush:
+		v := int16(cmd.n)
+
+		if cmd.seg != vm.Const {
+			addr, err := m.segAddr(cmd.seg, cmd.n)
+			if err != nil {
+				return err
+			}
+
+			v = m.ram[addr]
+		}
+
+		err := m.push(v)
+		if err != nil {
+			return err
+		}
+	case opPop:
+		addr, err := m.segAddr(cmd.seg, cmd.n)
+		if err != nil {
+			return err
+		}
+
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+
+		m.ram[addr] = v
+	case opArithmetic:
+		err := m.arithmetic(cmd.arith)
+		if err != nil {
+			return err
+		}
+	case opGoto:
+		m.pc = cmd.target
+		return nil
+	case opIfGoto:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+
+		if v != 0 {
+			m.pc = cmd.target
+			return nil
+		}
+	case opFunction:
+		for i := 0; i < cmd.n; i++ {
+			err := m.push(0)
+			if err != nil {
+				return err
+			}
+		}
+	case opCall:
+		if cmd.native == nil {
+			return m.call(cmd.name, cmd.target, cmd.n, m.pc+1)
+		}
+
+		err := m.callNative(cmd)
+		if err != nil {
+			return err
+		}
+	case opReturn:
+		return m.ret()
+	}
+
+	m.pc += 1
+
+	return nil
+}
+
+func (m *Machine) arithmetic(op vm.Op) error {
+	y, err := m.pop()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case vm.Neg:
+		return m.push(-y)
+	case vm.Not:
+		return m.push(^y)
+	}
+
+	x, err := m.pop()
+	if err != nil {
+		return err
+	}
+
+	var v int16
+
+	switch op {
+	case vm.Add:
+		v = x + y
+	case vm.Sub:
+		v = x - y
+	case vm.And:
+		v = x & y
+	case vm.Or:
+		v = x | y
+	case vm.Eq:
+		v = boolValue(x == y)
+	case vm.Gt:
+		v = boolValue(x > y)
+	case vm.Lt:
+		v = boolValue(x < y)
+	}
+
+	return m.push(v)
+}
+
+func (m *Machine) call(name string, target, nArgs, ret int) error {
+	for _, v := range []int16{int16(ret), m.ram[lcl], m.ram[arg], m.ram[this], m.ram[that]} {
+		err := m.push(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.ram[arg] = m.ram[sp] - int16(nArgs) - 5
+	m.ram[lcl] = m.ram[sp]
+
+	m.calls = append(m.calls, frame{name, ret})
+	m.pc = target
+
+	return nil
+}
+
+func (m *Machine) callNative(cmd *command) error {
+	if int(m.ram[sp])-cmd.n < stackBase {
+		return fmt.Errorf("stack underflow")
+	}
+
+	args := make([]int16, cmd.n)
+	copy(args, m.ram[int(m.ram[sp])-cmd.n:m.ram[sp]])
+	m.ram[sp] -= int16(cmd.n)
+
+	v, err := cmd.native(m, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.name, err)
+	}
+
+	return m.push(v)
+}
+
+func (m *Machine) ret() error {
+	if len(m.calls) == 0 {
+		return fmt.Errorf("return outside of a function")
+	}
+
+	fr := m.calls[len(m.calls)-1]
+	m.calls = m.calls[:len(m.calls)-1]
+
+	base := int(m.ram[lcl])
+	if base-5 < stackBase {
+		return fmt.Errorf("corrupted stack frame")
+	}
+
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+
+	addr := int(m.ram[arg])
+	if addr < stackBase || addr >= heapBase {
+		return fmt.Errorf("corrupted stack frame")
+	}
+
+	m.ram[addr] = v
+	m.ram[sp] = int16(addr + 1)
+	m.ram[that] = m.ram[base-1]
+	m.ram[this] = m.ram[base-2]
+	m.ram[arg] = m.ram[base-3]
+	m.ram[lcl] = m.ram[base-4]
+
+	if fr.ret < 0 {
+		m.halted = true
+		return nil
+	}
+
+	m.pc = fr.ret
+
+	return nil
+}
+
+func (m *Machine) segAddr(seg vm.MemSeg, n int) (int, error) {
+	var addr int
+
+	switch seg {
+	case vm.Local:
+		addr = int(m.ram[lcl]) + n
+	case vm.Arg:
+		addr = int(m.ram[arg]) + n
+	case vm.This:
+		addr = int(m.ram[this]) + n
+	case vm.That:
+		addr = int(m.ram[that]) + n
+	case vm.Static:
+		addr = n
+	case vm.Temp:
+		if n > 7 {
+			return 0, fmt.Errorf("temp index %d out of range", n)
+		}
+
+		addr = tempBase + n
+	case vm.Pointer:
+		if n > 1 {
+			return 0, fmt.Errorf("pointer index %d out of range", n)
+		}
+
+		addr = this + n
+	}
+
+	if addr < 0 || addr >= ramSize {
+		return 0, fmt.Errorf("address %d out of range", addr)
+	}
+
+	return addr, nil
+}
+
+func (m *Machine) push(v int16) error {
+	addr := int(m.ram[sp])
+	if addr < stackBase || addr >= heapBase {
+		return fmt.Errorf("stack overflow")
+	}
+
+	m.ram[addr] = v
+	m.ram[sp] += 1
+
+	return nil
+}
+
+func (m *Machine) pop() (int16, error) {
+	addr := int(m.ram[sp]) - 1
+	if addr < stackBase || addr >= heapBase {
+		return 0, fmt.Errorf("stack underflow")
+	}
+
+	m.ram[sp] -= 1
+
+	return m.ram[addr], nil
+}
+
+func (m *Machine) peek(addr int16) (int16, error) {
+	a, err := m.field(addr, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.ram[a], nil
+}
+
+func (m *Machine) poke(addr, v int16) error {
+	a, err := m.field(addr, 0)
+	if err != nil {
+		return err
+	}
+
+	m.ram[a] = v
+
+	return nil
+}
+
+func (m *Machine) currentFunc() string {
+	if len(m.calls) == 0 {
+		return ""
+	}
+
+	return m.calls[len(m.calls)-1].funcName
+}
+
+func className(funcName string) string {
+	return strings.SplitN(funcName, ".", 2)[0]
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,135 @@
+package interpreter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm/interpreter"
+)
+
+// run loads src as Main.vm and runs it, returning the output.
+func run(t *testing.T, src string) (string, error) {
+	t.Helper()
+
+	m := interpreter.New()
+	m.SetMaxSteps(10000)
+
+	if err := m.Load("Main", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Run()
+
+	return m.Output(), err
+}
+
+func TestRun(t *testing.T) {
+	src := `function Main.main 0
+push constant 6
+push constant 7
+call Math.multiply 2
+call Main.show 1
+pop temp 0
+push constant 0
+return
+function Main.show 0
+push argument 0
+call Output.printInt 1
+return
+`
+
+	out, err := run(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "42" {
+		t.Errorf("want output 42, got %q", out)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		msg  string
+	}{
+		{
+			"too few arguments to a stand-in",
+			"function Main.main 0\ncall Math.abs 0\nreturn\n",
+			"Main.main:2: Math.abs called with 0 arguments, takes 1",
+		},
+		{
+			"too many arguments to a stand-in",
+			"function Main.main 0\npush constant 1\npush constant 2\ncall Output.printInt 2\nreturn\n",
+			"Main.main:4: Output.printInt called with 2 arguments, takes 1",
+		},
+		{
+			"undefined function",
+			"function Main.main 0\ncall Main.nope 0\nreturn\n",
+			"undefined functions Main.nope",
+		},
+		{
+			"no return at the end of the code",
+			"function Main.main 0\npush constant 1\npop temp 0\n",
+			"Main.main: end of function reached without return",
+		},
+		{
+			"no return before the next function",
+			"function Main.main 0\npush constant 1\npop temp 0\nfunction Main.next 0\npush constant 0\nreturn\n",
+			"Main.main: end of function reached without return",
+		},
+		{
+			"step limit",
+			"function Main.main 0\nlabel LOOP\ngoto LOOP\n",
+			"step limit exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.src)
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("%s: want error %s, got %v", tt.name, tt.msg, err)
+		}
+	}
+}
+
+func TestSysError(t *testing.T) {
+	_, err := run(t, "function Main.main 0\npush constant 3\ncall Sys.error 1\nreturn\n")
+
+	var sysErr *interpreter.SysError
+	if !errors.As(err, &sysErr) || sysErr.Code != 3 {
+		t.Errorf("want ERR3, got %v", err)
+	}
+}
+
+func TestStandInReplacedByLoadedClass(t *testing.T) {
+	// a loaded Math class replaces the whole stand-in, whatever its
+	// functions take
+	src := `function Main.main 0
+call Math.abs 0
+call Output.printInt 1
+pop temp 0
+push constant 0
+return
+`
+
+	m := interpreter.New()
+
+	if err := m.Load("Main", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Load("Math", strings.NewReader("function Math.abs 0\npush constant 5\nreturn\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := m.Output(); out != "5" {
+		t.Errorf("want output 5, got %q", out)
+	}
+}
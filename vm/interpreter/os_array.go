@@ -0,0 +1,13 @@
+package interpreter
+
+func arrayNew(m *Machine, args []int16) (int16, error) {
+	if args[0] <= 0 {
+		return 0, &SysError{2}
+	}
+
+	return memoryAlloc(m, args)
+}
+
+func arrayDispose(m *Machine, args []int16) (int16, error) {
+	return memoryDeAlloc(m, args)
+}
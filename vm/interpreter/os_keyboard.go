@@ -0,0 +1,161 @@
+package interpreter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// keyboard feeds the characters of its input to the Keyboard class as if
+// they were typed by the user, or plays the events of a script.
+type keyboard struct {
+	in     *bufio.Reader
+	events []keyEvent
+	typed  []int16
+	frame  int
+}
+
+func newKeyboard() *keyboard {
+	return &keyboard{}
+}
+
+func (k *keyboard) setInput(in io.Reader) {
+	k.in = bufio.NewReader(in)
+}
+
+func (k *keyboard) setScript(s *Script) {
+	k.in = nil
+	k.events = append([]keyEvent{}, s.events...)
+}
+
+// nextFrame advances the time of the keyboard script by a frame.
+func (m *Machine) nextFrame() {
+	m.keyboard.frame += 1
+	m.playKeyEvents()
+}
+
+// playKeyEvents applies the script events due at the current frame.
+func (m *Machine) playKeyEvents() {
+	k := m.keyboard
+
+	for len(k.events) > 0 && k.events[0].frame <= k.frame {
+		e := k.events[0]
+		k.events = k.events[1:]
+
+		switch e.kind {
+		case press:
+			m.ram[KeyboardAddr] = e.keys[0]
+		case release:
+			m.ram[KeyboardAddr] = 0
+		case typeText:
+			k.typed = append(k.typed, e.keys...)
+		}
+	}
+}
+
+// readKey returns the Jack character set code of the next key typed. When
+// playing a script and no typed text is due, time skips forward to the next
+// event, as if the program had been waiting for it.
+func (m *Machine) readKey() (int16, error) {
+	k := m.keyboard
+
+	if k.in == nil {
+		for len(k.typed) == 0 {
+			if len(k.events) == 0 {
+				return 0, fmt.Errorf("keyboard input exhausted")
+			}
+
+			k.frame = k.events[0].frame
+			m.playKeyEvents()
+		}
+
+		c := k.typed[0]
+		k.typed = k.typed[1:]
+
+		return c, nil
+	}
+
+	for {
+		b, err := k.in.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, fmt.Errorf("keyboard input exhausted")
+			}
+
+			return 0, err
+		}
+
+		switch b {
+		case '\r':
+			continue
+		case '\n':
+			return newLine, nil
+		case '\b', 0x7f:
+			return backSpace, nil
+		}
+
+		return int16(b), nil
+	}
+}
+
+func keyboardKeyPressed(m *Machine, args []int16) (int16, error) {
+	return m.ram[KeyboardAddr], nil
+}
+
+func keyboardReadChar(m *Machine, args []int16) (int16, error) {
+	c, err := m.readKey()
+	if err != nil {
+		return 0, err
+	}
+
+	m.printChar(c)
+
+	return c, nil
+}
+
+func keyboardReadLine(m *Machine, args []int16) (int16, error) {
+	msg, err := m.stringValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	m.printString(msg)
+
+	line := []int16{}
+
+	for {
+		c, err := m.readKey()
+		if err != nil {
+			return 0, err
+		}
+
+		switch c {
+		case newLine:
+			m.println()
+			return m.newString(line)
+		case backSpace:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				m.backSpace()
+			}
+		default:
+			line = append(line, c)
+			m.printChar(c)
+		}
+	}
+}
+
+func keyboardReadInt(m *Machine, args []int16) (int16, error) {
+	str, err := keyboardReadLine(m, args)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := stringIntValue(m, []int16{str})
+	if err != nil {
+		return 0, err
+	}
+
+	return v, m.heap.deAlloc(int(str))
+}
@@ -0,0 +1,45 @@
+package interpreter
+
+func mathAbs(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return -args[0], nil
+	}
+
+	return args[0], nil
+}
+
+func mathMultiply(m *Machine, args []int16) (int16, error) {
+	return args[0] * args[1], nil
+}
+
+func mathDivide(m *Machine, args []int16) (int16, error) {
+	if args[1] == 0 {
+		return 0, &SysError{3}
+	}
+
+	return args[0] / args[1], nil
+}
+
+func mathMin(m *Machine, args []int16) (int16, error) {
+	if args[0] < args[1] {
+		return args[0], nil
+	}
+
+	return args[1], nil
+}
+
+func mathMax(m *Machine, args []int16) (int16, error) {
+	if args[0] > args[1] {
+		return args[0], nil
+	}
+
+	return args[1], nil
+}
+
+func mathSqrt(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, &SysError{4}
+	}
+
+	return int16(isqrt(int(args[0]))), nil
+}
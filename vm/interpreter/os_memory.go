@@ -0,0 +1,26 @@
+package interpreter
+
+func memoryPeek(m *Machine, args []int16) (int16, error) {
+	return m.peek(args[0])
+}
+
+func memoryPoke(m *Machine, args []int16) (int16, error) {
+	return 0, m.poke(args[0], args[1])
+}
+
+func memoryAlloc(m *Machine, args []int16) (int16, error) {
+	if args[0] <= 0 {
+		return 0, &SysError{5}
+	}
+
+	addr, ok := m.heap.alloc(int(args[0]))
+	if !ok {
+		return 0, &SysError{6}
+	}
+
+	return int16(addr), nil
+}
+
+func memoryDeAlloc(m *Machine, args []int16) (int16, error) {
+	return 0, m.heap.deAlloc(int(args[0]))
+}
@@ -0,0 +1,154 @@
+package interpreter
+
+import "strconv"
+
+const (
+	outputRows = 23
+	outputCols = 64
+	charHeight = 11
+)
+
+// output keeps the cursor of the Output class and a transcript of the text
+// printed by the program. The characters are also drawn into the screen
+// memory map like the Jack OS does.
+type output struct {
+	row, col int
+	text     []rune
+}
+
+func newOutput() *output {
+	return &output{}
+}
+
+func (o *output) String() string {
+	return string(o.text)
+}
+
+func (m *Machine) printChar(c int16) {
+	o := m.output
+
+	switch c {
+	case newLine:
+		m.println()
+		return
+	case backSpace:
+		m.backSpace()
+		return
+	}
+
+	if c >= 32 && c <= 126 {
+		o.text = append(o.text, rune(c))
+	} else {
+		o.text = append(o.text, '■')
+	}
+
+	m.drawChar(c)
+
+	o.col += 1
+	if o.col == outputCols {
+		o.col = 0
+		o.row = (o.row + 1) % outputRows
+	}
+}
+
+func (m *Machine) println() {
+	o := m.output
+
+	o.text = append(o.text, '\n')
+	o.col = 0
+	o.row = (o.row + 1) % outputRows
+}
+
+func (m *Machine) backSpace() {
+	o := m.output
+
+	if len(o.text) > 0 {
+		o.text = o.text[:len(o.text)-1]
+	}
+
+	if o.col > 0 {
+		o.col -= 1
+	} else if o.row > 0 {
+		o.row -= 1
+		o.col = outputCols - 1
+	}
+
+	m.drawChar(' ')
+}
+
+// drawChar draws c into the character cell at the cursor. Every word of the
+// screen holds a row of two cells, the even column in the low byte.
+func (m *Machine) drawChar(c int16) {
+	o := m.output
+
+	bitmap, exists := font[c]
+	if !exists {
+		bitmap = font[0]
+	}
+
+	addr := ScreenBase + o.row*charHeight*screenWords + o.col/2
+
+	for i, bits := range bitmap {
+		word := &m.ram[addr+i*screenWords]
+
+		if o.col%2 == 0 {
+			*word = *word&^0xff | bits
+		} else {
+			*word = *word&0xff | bits<<8
+		}
+	}
+}
+
+func (m *Machine) printString(str []int16) {
+	for _, c := range str {
+		m.printChar(c)
+	}
+}
+
+func outputMoveCursor(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 || args[0] >= outputRows || args[1] < 0 || args[1] >= outputCols {
+		return 0, &SysError{20}
+	}
+
+	m.output.row = int(args[0])
+	m.output.col = int(args[1])
+
+	return 0, nil
+}
+
+func outputPrintChar(m *Machine, args []int16) (int16, error) {
+	m.printChar(args[0])
+
+	return 0, nil
+}
+
+func outputPrintString(m *Machine, args []int16) (int16, error) {
+	str, err := m.stringValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	m.printString(str)
+
+	return 0, nil
+}
+
+func outputPrintInt(m *Machine, args []int16) (int16, error) {
+	for _, c := range strconv.Itoa(int(args[0])) {
+		m.printChar(int16(c))
+	}
+
+	return 0, nil
+}
+
+func outputPrintln(m *Machine, args []int16) (int16, error) {
+	m.println()
+
+	return 0, nil
+}
+
+func outputBackSpace(m *Machine, args []int16) (int16, error) {
+	m.backSpace()
+
+	return 0, nil
+}
@@ -0,0 +1,168 @@
+package interpreter
+
+const (
+	screenWidth  = 512
+	screenHeight = 256
+	screenWords  = screenWidth / 16
+)
+
+// screen keeps the drawing color of the Screen class, black being true.
+type screen struct {
+	color bool
+}
+
+func newScreen() *screen {
+	return &screen{true}
+}
+
+func (m *Machine) setPixel(x, y int, black bool) {
+	addr := ScreenBase + y*screenWords + x/16
+	bit := int16(1) << uint(x%16)
+
+	if black {
+		m.ram[addr] |= bit
+	} else {
+		m.ram[addr] &^= bit
+	}
+}
+
+// fillRow draws the pixels from x1 to x2 of row y, clipping them to the
+// screen.
+func (m *Machine) fillRow(x1, x2, y int) {
+	if y < 0 || y >= screenHeight {
+		return
+	}
+
+	if x1 < 0 {
+		x1 = 0
+	}
+
+	if x2 >= screenWidth {
+		x2 = screenWidth - 1
+	}
+
+	for x := x1; x <= x2; x++ {
+		m.setPixel(x, y, m.screen.color)
+	}
+}
+
+func onScreen(x, y int16) bool {
+	return x >= 0 && x < screenWidth && y >= 0 && y < screenHeight
+}
+
+func screenClearScreen(m *Machine, args []int16) (int16, error) {
+	for i := ScreenBase; i < KeyboardAddr; i++ {
+		m.ram[i] = 0
+	}
+
+	return 0, nil
+}
+
+func screenSetColor(m *Machine, args []int16) (int16, error) {
+	m.screen.color = args[0] != 0
+
+	return 0, nil
+}
+
+func screenDrawPixel(m *Machine, args []int16) (int16, error) {
+	if !onScreen(args[0], args[1]) {
+		return 0, &SysError{7}
+	}
+
+	m.setPixel(int(args[0]), int(args[1]), m.screen.color)
+
+	return 0, nil
+}
+
+func screenDrawLine(m *Machine, args []int16) (int16, error) {
+	if !onScreen(args[0], args[1]) || !onScreen(args[2], args[3]) {
+		return 0, &SysError{8}
+	}
+
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := sign(x2-x1), sign(y2-y1)
+	diff := dx + dy
+
+	for {
+		m.setPixel(x1, y1, m.screen.color)
+
+		if x1 == x2 && y1 == y2 {
+			return 0, nil
+		}
+
+		e := 2 * diff
+
+		if e >= dy {
+			diff += dy
+			x1 += sx
+		}
+
+		if e <= dx {
+			diff += dx
+			y1 += sy
+		}
+	}
+}
+
+func screenDrawRectangle(m *Machine, args []int16) (int16, error) {
+	if !onScreen(args[0], args[1]) || !onScreen(args[2], args[3]) || args[0] > args[2] || args[1] > args[3] {
+		return 0, &SysError{9}
+	}
+
+	for y := int(args[1]); y <= int(args[3]); y++ {
+		m.fillRow(int(args[0]), int(args[2]), y)
+	}
+
+	return 0, nil
+}
+
+func screenDrawCircle(m *Machine, args []int16) (int16, error) {
+	if !onScreen(args[0], args[1]) {
+		return 0, &SysError{12}
+	}
+
+	r := int(args[2])
+	if r < 0 || r > 181 {
+		return 0, &SysError{13}
+	}
+
+	x, y := int(args[0]), int(args[1])
+
+	for dy := -r; dy <= r; dy++ {
+		half := isqrt(r*r - dy*dy)
+		m.fillRow(x-half, x+half, y+dy)
+	}
+
+	return 0, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isqrt(x int) int {
+	y := 0
+
+	for (y+1)*(y+1) <= x {
+		y++
+	}
+
+	return y
+}
@@ -0,0 +1,223 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A string is a heap block holding the maximum length, the length and the
+// characters of the string.
+const (
+	strMaxLen = iota
+	strLength
+	strChars
+)
+
+func stringNew(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, &SysError{14}
+	}
+
+	addr, ok := m.heap.alloc(int(args[0]) + strChars)
+	if !ok {
+		return 0, &SysError{6}
+	}
+
+	m.ram[addr+strMaxLen] = args[0]
+	m.ram[addr+strLength] = 0
+
+	return int16(addr), nil
+}
+
+func stringDispose(m *Machine, args []int16) (int16, error) {
+	return memoryDeAlloc(m, args)
+}
+
+func stringLength(m *Machine, args []int16) (int16, error) {
+	addr, err := m.field(args[0], strLength)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.ram[addr], nil
+}
+
+func stringCharAt(m *Machine, args []int16) (int16, error) {
+	str, err := m.stringValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if args[1] < 0 || int(args[1]) >= len(str) {
+		return 0, &SysError{15}
+	}
+
+	return str[args[1]], nil
+}
+
+func stringSetCharAt(m *Machine, args []int16) (int16, error) {
+	str, err := m.stringValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if args[1] < 0 || int(args[1]) >= len(str) {
+		return 0, &SysError{16}
+	}
+
+	m.ram[int(args[0])+strChars+int(args[1])] = args[2]
+
+	return 0, nil
+}
+
+func stringAppendChar(m *Machine, args []int16) (int16, error) {
+	maxLen, length, err := m.stringLengths(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if length >= maxLen {
+		return 0, &SysError{17}
+	}
+
+	m.ram[int(args[0])+strChars+length] = args[1]
+	m.ram[int(args[0])+strLength] = int16(length + 1)
+
+	return args[0], nil
+}
+
+func stringEraseLastChar(m *Machine, args []int16) (int16, error) {
+	_, length, err := m.stringLengths(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if length <= 0 {
+		return 0, &SysError{18}
+	}
+
+	m.ram[int(args[0])+strLength] = int16(length - 1)
+
+	return 0, nil
+}
+
+func stringIntValue(m *Machine, args []int16) (int16, error) {
+	str, err := m.stringValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	v := int16(0)
+	neg := false
+
+	for i, c := range str {
+		if i == 0 && c == '-' {
+			neg = true
+			continue
+		}
+
+		if c < '0' || c > '9' {
+			break
+		}
+
+		v = v*10 + c - '0'
+	}
+
+	if neg {
+		return -v, nil
+	}
+
+	return v, nil
+}
+
+func stringSetInt(m *Machine, args []int16) (int16, error) {
+	maxLen, _, err := m.stringLengths(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	digits := strconv.Itoa(int(args[1]))
+	if len(digits) > maxLen {
+		return 0, &SysError{19}
+	}
+
+	for i, c := range digits {
+		m.ram[int(args[0])+strChars+i] = int16(c)
+	}
+
+	m.ram[int(args[0])+strLength] = int16(len(digits))
+
+	return 0, nil
+}
+
+func stringBackSpace(m *Machine, args []int16) (int16, error) {
+	return backSpace, nil
+}
+
+func stringDoubleQuote(m *Machine, args []int16) (int16, error) {
+	return doubleQuote, nil
+}
+
+func stringNewLine(m *Machine, args []int16) (int16, error) {
+	return newLine, nil
+}
+
+// stringLengths returns the maximum length and the length of the string
+// object at addr, checking that the whole object lies within the RAM.
+func (m *Machine) stringLengths(addr int16) (int, int, error) {
+	lenAddr, err := m.field(addr, strLength)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxLen := int(m.ram[int(addr)+strMaxLen])
+	length := int(m.ram[lenAddr])
+
+	if maxLen < 0 || length < 0 || length > maxLen || int(addr)+strChars+maxLen > ramSize {
+		return 0, 0, fmt.Errorf("%d is not a string object", addr)
+	}
+
+	return maxLen, length, nil
+}
+
+// stringValue returns the characters of the string object at addr.
+func (m *Machine) stringValue(addr int16) ([]int16, error) {
+	_, length, err := m.stringLengths(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(addr) + strChars
+
+	str := make([]int16, length)
+	copy(str, m.ram[start:start+length])
+
+	return str, nil
+}
+
+// newString allocates a string object holding str.
+func (m *Machine) newString(str []int16) (int16, error) {
+	addr, err := stringNew(m, []int16{int16(len(str))})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range str {
+		_, err = stringAppendChar(m, []int16{addr, c})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return addr, nil
+}
+
+// field returns the RAM address of the i:th field of the object at obj.
+func (m *Machine) field(obj int16, i int) (int, error) {
+	addr := int(obj) + i
+	if obj < 0 || addr >= ramSize {
+		return 0, fmt.Errorf("address %d out of range", addr)
+	}
+
+	return addr, nil
+}
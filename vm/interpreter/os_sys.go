@@ -0,0 +1,31 @@
+package interpreter
+
+func sysHalt(m *Machine, args []int16) (int16, error) {
+	m.halted = true
+
+	return 0, nil
+}
+
+func sysError(m *Machine, args []int16) (int16, error) {
+	for _, c := range "ERR" {
+		m.printChar(int16(c))
+	}
+
+	outputPrintInt(m, args)
+
+	return 0, &SysError{args[0]}
+}
+
+func sysWait(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, &SysError{1}
+	}
+
+	m.nextFrame()
+
+	if m.waitHook != nil {
+		return 0, m.waitHook(args[0])
+	}
+
+	return 0, nil
+}
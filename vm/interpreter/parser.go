@@ -0,0 +1,186 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/vm"
+)
+
+type opcode int
+
+const (
+	opPush opcode = iota
+	opPop
+	opArithmetic
+	opLabel
+	opGoto
+	opIfGoto
+	opFunction
+	opCall
+	opReturn
+)
+
+type command struct {
+	op     opcode
+	arith  vm.Op
+	seg    vm.MemSeg
+	n      int
+	name   string
+	target int
+	native builtin
+	lineNo int
+}
+
+var arithmetic = map[vm.Op]bool{
+	vm.Add: true,
+	vm.Sub: true,
+	vm.Eq:  true,
+	vm.Gt:  true,
+	vm.Lt:  true,
+	vm.And: true,
+	vm.Or:  true,
+	vm.Neg: true,
+	vm.Not: true,
+}
+
+var segments = map[vm.MemSeg]bool{
+	vm.Const:   true,
+	vm.Arg:     true,
+	vm.Local:   true,
+	vm.Static:  true,
+	vm.This:    true,
+	vm.That:    true,
+	vm.Pointer: true,
+	vm.Temp:    true,
+}
+
+// parse reads the VM commands of a single file. Jump targets are resolved
+// within the file, call targets are left for the machine to link.
+func parse(fileName string, in io.Reader) ([]command, error) {
+	cmds := []command{}
+	labels := map[string]int{}
+	funcName := ""
+
+	sc := bufio.NewScanner(in)
+	lineNo := 0
+
+	for sc.Scan() {
+		lineNo += 1
+
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		cmd, err := parseCommand(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s.vm:%d: %s", fileName, lineNo, err)
+		}
+
+		cmd.lineNo = lineNo
+
+		switch cmd.op {
+		case opFunction:
+			funcName = cmd.name
+		case opLabel, opGoto, opIfGoto:
+			cmd.name = funcName + "$" + cmd.name
+		}
+
+		if cmd.op == opLabel {
+			if _, exists := labels[cmd.name]; exists {
+				return nil, fmt.Errorf("%s.vm:%d: label %s declared twice", fileName, lineNo, cmd.name)
+			}
+
+			labels[cmd.name] = len(cmds)
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range cmds {
+		if cmds[i].op != opGoto && cmds[i].op != opIfGoto {
+			continue
+		}
+
+		target, exists := labels[cmds[i].name]
+		if !exists {
+			return nil, fmt.Errorf("%s.vm:%d: undefined label %s", fileName, cmds[i].lineNo, cmds[i].name)
+		}
+
+		cmds[i].target = target
+	}
+
+	return cmds, nil
+}
+
+func parseCommand(fields []string) (command, error) {
+	name := fields[0]
+
+	if op := vm.Op(name); arithmetic[op] {
+		return command{op: opArithmetic, arith: op}, nil
+	}
+
+	if name == "return" {
+		return command{op: opReturn}, nil
+	}
+
+	if len(fields) < 2 {
+		return command{}, fmt.Errorf("malformed command %q", strings.Join(fields, " "))
+	}
+
+	switch name {
+	case "label":
+		return command{op: opLabel, name: fields[1]}, nil
+	case "goto":
+		return command{op: opGoto, name: fields[1]}, nil
+	case "if-goto":
+		return command{op: opIfGoto, name: fields[1]}, nil
+	}
+
+	if len(fields) < 3 {
+		return command{}, fmt.Errorf("malformed command %q", strings.Join(fields, " "))
+	}
+
+	n, err := strconv.ParseUint(fields[2], 10, 15)
+	if err != nil {
+		return command{}, fmt.Errorf("invalid number %q", fields[2])
+	}
+
+	switch name {
+	case "push", "pop":
+		seg := vm.MemSeg(fields[1])
+		if !segments[seg] {
+			return command{}, fmt.Errorf("unknown segment %q", fields[1])
+		}
+
+		op := opPush
+		if name == "pop" {
+			op = opPop
+		}
+
+		if op == opPop && seg == vm.Const {
+			return command{}, fmt.Errorf("cannot pop to the constant segment")
+		}
+
+		return command{op: op, seg: seg, n: int(n)}, nil
+	case "function":
+		return command{op: opFunction, name: fields[1], n: int(n)}, nil
+	case "call":
+		return command{op: opCall, name: fields[1], n: int(n)}, nil
+	}
+
+	return command{}, fmt.Errorf("unknown command %q", name)
+}
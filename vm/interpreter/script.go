@@ -0,0 +1,183 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type eventKind int
+
+const (
+	press eventKind = iota
+	release
+	typeText
+)
+
+type keyEvent struct {
+	frame int
+	kind  eventKind
+	keys  []int16
+}
+
+// Script is a list of timed keyboard events. Time is measured in frames, a
+// frame passing every time the program calls Sys.wait. Every line of a script
+// holds one event, optionally prefixed with the frame it happens at:
+//
+//	frame 10 press LEFT
+//	frame 14 release
+//	type "hello\n"
+//
+// An event without a frame happens at the frame of the previous event.
+// Pressed keys are seen by Keyboard.keyPressed until released, typed text is
+// read by Keyboard.readChar, readLine and readInt.
+type Script struct {
+	events []keyEvent
+}
+
+var keyNames = map[string]int16{
+	"SPACE":     ' ',
+	"NEWLINE":   newLine,
+	"ENTER":     newLine,
+	"BACKSPACE": backSpace,
+	"LEFT":      130,
+	"UP":        131,
+	"RIGHT":     132,
+	"DOWN":      133,
+	"HOME":      134,
+	"END":       135,
+	"PAGEUP":    136,
+	"PAGEDOWN":  137,
+	"INSERT":    138,
+	"DELETE":    139,
+	"ESC":       140,
+}
+
+func ParseScript(in io.Reader) (*Script, error) {
+	s := &Script{}
+	frame := 0
+
+	sc := bufio.NewScanner(in)
+	lineNo := 0
+
+	for sc.Scan() {
+		lineNo += 1
+
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "frame ") {
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: missing event", lineNo)
+			}
+
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < frame {
+				return nil, fmt.Errorf("line %d: invalid frame %q", lineNo, fields[1])
+			}
+
+			frame = n
+			line = strings.TrimSpace(fields[2])
+		}
+
+		e, err := parseEvent(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+
+		e.frame = frame
+		s.events = append(s.events, e)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].frame < s.events[j].frame
+	})
+
+	return s, nil
+}
+
+func parseEvent(line string) (keyEvent, error) {
+	fields := strings.SplitN(line, " ", 2)
+
+	switch fields[0] {
+	case "release":
+		if len(fields) != 1 {
+			return keyEvent{}, fmt.Errorf("release takes no arguments")
+		}
+
+		return keyEvent{kind: release}, nil
+	case "press":
+		if len(fields) != 2 {
+			return keyEvent{}, fmt.Errorf("missing key to press")
+		}
+
+		key, err := parseKey(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return keyEvent{}, err
+		}
+
+		return keyEvent{kind: press, keys: []int16{key}}, nil
+	case "type":
+		if len(fields) != 2 {
+			return keyEvent{}, fmt.Errorf("missing text to type")
+		}
+
+		text, err := strconv.Unquote(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return keyEvent{}, fmt.Errorf("invalid text %s", fields[1])
+		}
+
+		keys := []int16{}
+		for _, r := range text {
+			keys = append(keys, charKey(r))
+		}
+
+		return keyEvent{kind: typeText, keys: keys}, nil
+	}
+
+	return keyEvent{}, fmt.Errorf("unknown event %q", fields[0])
+}
+
+// parseKey accepts a single character, a key name or a key code.
+func parseKey(s string) (int16, error) {
+	if code, exists := keyNames[strings.ToUpper(s)]; exists {
+		return code, nil
+	}
+
+	if len(s) > 1 && (s[0] == 'F' || s[0] == 'f') {
+		if n, err := strconv.Atoi(s[1:]); err == nil && n >= 1 && n <= 12 {
+			return int16(140 + n), nil
+		}
+	}
+
+	if len(s) == 1 {
+		return charKey(rune(s[0])), nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && n < 256 {
+		return int16(n), nil
+	}
+
+	return 0, fmt.Errorf("unknown key %q", s)
+}
+
+func charKey(r rune) int16 {
+	switch r {
+	case '\n':
+		return newLine
+	case '\b':
+		return backSpace
+	}
+
+	return int16(r)
+}
@@ -2,14 +2,14 @@ package vm
 
 import (
 	"fmt"
-	"os"
+	"io"
 )
 
 type (
 	Op     string
 	MemSeg string
 	Writer struct {
-		out    *os.File
+		out    io.Writer
 		lblIdx uint
 	}
 )
@@ -40,7 +40,7 @@ type MemEntry struct {
 	Idx uint
 }
 
-func New(out *os.File) *Writer {
+func New(out io.Writer) *Writer {
 	return &Writer{out, 0}
 }
 
@@ -80,8 +80,23 @@ func (w *Writer) WriteReturn() {
 	w.writeLine("return")
 }
 
+// Divert sends the code written from now on to out and returns where the
+// code went before. It lets the compiler emit code in an order different
+// from the one it is read in.
+func (w *Writer) Divert(out io.Writer) io.Writer {
+	prev := w.out
+	w.out = out
+
+	return prev
+}
+
+// WriteCode writes code diverted earlier.
+func (w *Writer) WriteCode(code []byte) {
+	w.out.Write(code)
+}
+
 func (w *Writer) writeLine(s string) {
-	w.out.WriteString(s + "\n")
+	io.WriteString(w.out, s+"\n")
 }
 
 func (w *Writer) RegisterLabel(lbl string) string {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/pqkallio/nand2tetris-jack-compiler/index"
+	"github.com/pqkallio/nand2tetris-jack-compiler/tokenizer"
+)
+
+// xrefCommand prints the declarations of a program and the references to
+// them as JSON.
+func xrefCommand(args []string) {
+	fs := flag.NewFlagSet("xref", flag.ExitOnError)
+	lang := fs.String("lang", "jack", "language: jack, or jack+ for the extensions")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatalf("please provide only the file or folder to cross-reference")
+	}
+
+	idx, err := loadIndex(fs.Arg(0), language(*lang))
+	if err != nil {
+		log.Fatalf("unable to read %s: %s", fs.Arg(0), err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(idx.Report())
+	if err != nil {
+		log.Fatalf("unable to write the cross-reference: %s", err)
+	}
+}
+
+// loadIndex indexes the file path or the .jack files of the directory path.
+func loadIndex(path string, l tokenizer.Lang) (*index.Index, error) {
+	files, err := sourceFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := index.New()
+	idx.SetLang(l)
+
+	err = idx.AddFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}